@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+)
+
+const baselineSchemaID = "gred/baseline/v1"
+
+// baseline holds the matches known of, which -baseline suppresses. Matches
+// are known by the path and CRC of their line, so they are still known when
+// lines are added or removed above them. Each is counted, so that a line
+// repeated once more than before is reported.
+type baseline struct {
+	path string
+	// known are the matches read from the file, seen those found so far
+	known, seen map[baselineKey]int
+	// update writes the matches found back to the file
+	update bool
+}
+
+type baselineKey struct {
+	path, crc string
+}
+
+type baselineFile struct {
+	Schema  string          `json:"schema"`
+	Matches []baselineMatch `json:"matches"`
+}
+
+type baselineMatch struct {
+	Path  string `json:"path"`
+	CRC   string `json:"crc"`
+	Count int    `json:"count"`
+}
+
+// readBaseline reads the baseline at path. A missing file is an empty
+// baseline, to be written with -update-baseline.
+func readBaseline(path string, update bool) (*baseline, error) {
+	b := &baseline{
+		path:   path,
+		known:  make(map[baselineKey]int),
+		seen:   make(map[baselineKey]int),
+		update: update,
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return b, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var f baselineFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if f.Schema != baselineSchemaID {
+		return nil, fmt.Errorf("%s: schema is %q, not %s", path, f.Schema, baselineSchemaID)
+	}
+	for _, m := range f.Matches {
+		b.known[baselineKey{m.Path, m.CRC}] += m.Count
+	}
+	return b, nil
+}
+
+// suppress counts the match of the line with crc in path, and reports
+// whether the baseline already knows of it. Every match is new when the
+// baseline is being updated.
+func (b *baseline) suppress(path string, crc []byte) bool {
+	key := baselineKey{path, string(crc)}
+	b.seen[key]++
+	return !b.update && b.seen[key] <= b.known[key]
+}
+
+func (b *baseline) write() error {
+	f := baselineFile{Schema: baselineSchemaID, Matches: []baselineMatch{}}
+	for key, n := range b.seen {
+		f.Matches = append(f.Matches, baselineMatch{key.path, key.crc, n})
+	}
+	sort.Slice(f.Matches, func(i, j int) bool {
+		mi, mj := f.Matches[i], f.Matches[j]
+		if mi.Path != mj.Path {
+			return mi.Path < mj.Path
+		}
+		return mi.CRC < mj.CRC
+	})
+	data, err := json.MarshalIndent(f, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(b.path, append(data, '\n'), 0666)
+}
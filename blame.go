@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// blameLine is who last changed a line, from git blame.
+type blameLine struct {
+	Commit string `json:"commit"`
+	Author string `json:"author"`
+	Mail   string `json:"mail,omitempty"`
+	// Time is in the author's time zone
+	Time time.Time `json:"time"`
+}
+
+// blamer runs git blame once for each file with matches, the first time
+// one of its lines is printed, and holds the result until the file is
+// searched.
+type blamer struct {
+	mu    sync.Mutex
+	files map[string][]*blameLine
+}
+
+func newBlamer() *blamer {
+	return &blamer{files: make(map[string][]*blameLine)}
+}
+
+// line returns the blame of the line of path, or nil when git could not
+// blame the file.
+func (b *blamer) line(path string, lineno int) *blameLine {
+	b.mu.Lock()
+	lines, ok := b.files[path]
+	b.mu.Unlock()
+	if !ok {
+		var err error
+		if lines, err = gitBlame(path); err != nil {
+			warn("%v", err)
+		}
+		// a file which cannot be blamed is only warned of once
+		b.mu.Lock()
+		b.files[path] = lines
+		b.mu.Unlock()
+	}
+	if lineno < 1 || lineno > len(lines) {
+		return nil
+	}
+	return lines[lineno-1]
+}
+
+// forget drops the blame of path once it has been searched.
+func (b *blamer) forget(path string) {
+	b.mu.Lock()
+	delete(b.files, path)
+	b.mu.Unlock()
+}
+
+// gitBlame blames every line of path, by reading the header of each line
+// of git blame --porcelain. The details of a commit are only given for the
+// first line which it changed.
+func gitBlame(path string) ([]*blameLine, error) {
+	cmd := exec.Command("git", "blame", "--porcelain", "--", path)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git blame %s: %v: %s", path, err, strings.TrimSpace(stderr.String()))
+	}
+	var lines []*blameLine
+	commits := make(map[string]*blameLine)
+	var cur *blameLine
+	scan := bufio.NewScanner(bytes.NewReader(out))
+	scan.Buffer(nil, maxPatchLine)
+	for scan.Scan() {
+		line := scan.Text()
+		if strings.HasPrefix(line, "\t") {
+			// the content of the line, which ends its header
+			lines = append(lines, cur)
+			continue
+		}
+		key, value, _ := cutString(line, " ")
+		switch key {
+		case "author":
+			cur.Author = value
+		case "author-mail":
+			cur.Mail = strings.Trim(value, "<>")
+		case "author-time":
+			t, _ := strconv.ParseInt(value, 10, 64)
+			cur.Time = time.Unix(t, 0)
+		case "author-tz":
+			// like +0100, which follows author-time
+			if tz, err := strconv.Atoi(value); err == nil {
+				offset := (tz/100*60 + tz%100) * 60
+				cur.Time = cur.Time.In(time.FixedZone(value, offset))
+			}
+		default:
+			// SHA-1 or SHA-256
+			if len(key) < 40 || strings.Trim(key, "0123456789abcdef") != "" {
+				continue
+			}
+			// a line header: the commit and its line numbers
+			if cur = commits[key]; cur == nil {
+				cur = &blameLine{Commit: key}
+				commits[key] = cur
+			}
+		}
+	}
+	return lines, scan.Err()
+}
+
+// printBlame prints the blame of a match line as a comment above it, which
+// patch mode ignores.
+func printBlame(w io.Writer, bl *blameLine) {
+	fmt.Fprintf(w, "# %.8s %s %s <%s>\n", bl.Commit, bl.Time.Format("2006-01-02"), bl.Author, bl.Mail)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// maxCachedSearches is how many searches results are kept for, the least
+// recently run being removed first.
+const maxCachedSearches = 32
+
+// cacheSettle is how long a file must go unmodified before its results are
+// cached, since a file changed again within the resolution of its mtime,
+// and to the same size, would look unchanged.
+const cacheSettle = 2 * time.Second
+
+// A resultCache holds the output of a search for each file searched, with
+// the freshness of the file then, so that running the same search again
+// only searches the files which changed. It is kept for each search, by
+// a hash of its directory, flags, patterns and GREDX, in $GRED_CACHE or
+// else gred/results in the user's cache directory. Entries are only found
+// stale, and replaced, as their files are searched again.
+type resultCache struct {
+	path    string
+	entries map[string]cachedResult
+	// dirty is set once an entry is added, replaced or removed, guarded
+	// by the mu of the search
+	dirty bool
+}
+
+type cachedResult struct {
+	Size  int64
+	Mtime time.Time
+	Out   []byte
+}
+
+// cacheDir is $GRED_CACHE, or else gred/results in the user's cache
+// directory. It is empty when GRED_CACHE is -, which turns the cache off.
+func cacheDir() (string, error) {
+	if dir := os.Getenv("GRED_CACHE"); dir == "-" {
+		return "", nil
+	} else if dir != "" {
+		return dir, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gred", "results"), nil
+}
+
+// cacheable reports whether the output for each file depends only on the
+// file and the search: it does not with state shared between files, such as
+// -unique, -sample, -max-total or -collapse keep, with matches left out by
+// git, baselines, CODEOWNERS or -file-timeout, or with -why-skipped, whose
+// reasons are only found by searching. Searches for rules, from -preset, -f
+// or a profile, are not cached either, since they are mostly for secrets
+// and other lines best not written out again.
+func (s *searchConfig) cacheable() bool {
+	return s.blame == nil && s.changed == nil && s.baseline == nil && s.owners == nil && s.dedup == nil &&
+		!s.unique && s.sample == nil && s.maxTotal == 0 && s.rank == nil && s.groups == nil &&
+		s.timeout == 0 && !s.whySkipped && s.rev == nil && s.rules == nil && fileFlags == nil
+}
+
+// openResultCache reads the cache of the search s, which is nil when the
+// cache is off. A search without one starts with an empty cache.
+func openResultCache(s *searchConfig) (*resultCache, error) {
+	dir, err := cacheDir()
+	if dir == "" || err != nil {
+		return nil, err
+	}
+	c := &resultCache{path: filepath.Join(dir, s.cacheKey()), entries: make(map[string]cachedResult)}
+	f, err := os.Open(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := gob.NewDecoder(f).Decode(&c.entries); err != nil {
+		// a cache is only ever rebuilt
+		c.entries = make(map[string]cachedResult)
+		c.dirty = true
+	}
+	return c, nil
+}
+
+// cacheKey hashes what the output of the search depends on besides the
+// files: the directory searched from, the value of every flag, however it
+// was set, the patterns and rules, GREDX and how lines are printed.
+func (s *searchConfig) cacheKey() string {
+	h := sha256.New()
+	root, _ := os.Getwd()
+	fmt.Fprintf(h, "root\t%s\n", root)
+	flag.VisitAll(func(f *flag.Flag) {
+		fmt.Fprintf(h, "-%s\t%s\n", f.Name, f.Value)
+	})
+	for _, re := range s.pats {
+		fmt.Fprintf(h, "pattern\t%s\n", re)
+	}
+	for _, r := range s.rules {
+		fmt.Fprintf(h, "rule\t%+v\n", *r)
+	}
+	for _, name := range []string{"GREDX", "GRED_SEP", "GRED_HYPERLINK"} {
+		fmt.Fprintf(h, "%s\t%s\n", name, os.Getenv(name))
+	}
+	fmt.Fprintf(h, "color\t%v\tlink\t%v\n", s.color, s.link != nil)
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// grep writes the output for path from the cache while the file is as it
+// was, else searches it to cache the output again.
+func (c *resultCache) grep(w io.Writer, path string, s *searchConfig) error {
+	finfo, err := os.Stat(longPath(path))
+	if err != nil || !finfo.Mode().IsRegular() {
+		return grepFile(w, path, s)
+	}
+	key := filepath.Clean(path)
+	fresh := freshness{finfo.Size(), finfo.ModTime()}
+	s.mu.Lock()
+	r, ok := c.entries[key]
+	s.mu.Unlock()
+	if ok && fresh.same(freshness{r.Size, r.Mtime}) {
+		if len(r.Out) > 0 {
+			w.Write(r.Out)
+			s.mu.Lock()
+			s.summary.matched++
+			s.mu.Unlock()
+		}
+		return nil
+	}
+	var out bytes.Buffer
+	err = grepFile(io.MultiWriter(w, &out), path, s)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case err == nil && time.Since(fresh.mtime) >= cacheSettle:
+		c.entries[key] = cachedResult{fresh.size, fresh.mtime, out.Bytes()}
+		c.dirty = true
+	case ok:
+		delete(c.entries, key)
+		c.dirty = true
+	}
+	return err
+}
+
+// write saves the cache if it changed, and removes the caches of the
+// searches run longest ago beyond maxCachedSearches.
+func (c *resultCache) write() error {
+	if !c.dirty {
+		// the cache is still touched, as used most recently
+		now := time.Now()
+		os.Chtimes(c.path, now, now)
+		return nil
+	}
+	// the output cached is the user's alone, as CreateTemp makes the file
+	dir := filepath.Dir(c.path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, tempPrefix)
+	if err != nil {
+		return err
+	}
+	err = gob.NewEncoder(f).Encode(c.entries)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), c.path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	type cached struct {
+		path  string
+		mtime time.Time
+	}
+	var caches []cached
+	for _, e := range entries {
+		if finfo, err := e.Info(); err == nil && finfo.Mode().IsRegular() && e.Name()[0] != '.' {
+			caches = append(caches, cached{filepath.Join(dir, e.Name()), finfo.ModTime()})
+		}
+	}
+	sort.Slice(caches, func(i, j int) bool { return caches[i].mtime.After(caches[j].mtime) })
+	for i := maxCachedSearches; i < len(caches); i++ {
+		os.Remove(caches[i].path)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// tempPrefix starts the names of the temporary files patches are written
+// to, so that any left behind by a crash can be found by gred clean.
+const tempPrefix = ".gred-tmp-"
+
+// cleanMode removes stale patch temporary files under the directories in
+// args, or the current directory.
+func cleanMode(args []string) {
+	flags := flag.NewFlagSet("clean", flag.ExitOnError)
+	dryRun := flags.Bool("n", false, "only list the stale files")
+	minAge := flags.Duration("min-age", 10*time.Minute, "leave files modified more recently than `DURATION`")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: gred clean [-n] [-min-age DURATION] [dir ...]")
+		flags.PrintDefaults()
+		os.Exit(2)
+	}
+	flags.Parse(args)
+	dirs := flags.Args()
+	if len(dirs) == 0 {
+		dirs = []string{"."}
+	}
+
+	inUse := openFiles()
+	failed := false
+	for _, dir := range dirs {
+		for _, path := range staleTemps(dir, *minAge, inUse) {
+			if *dryRun {
+				fmt.Println(path)
+				continue
+			}
+			if err := os.Remove(path); err != nil {
+				warn("%v", err)
+				failed = true
+				continue
+			}
+			fmt.Printf("removed %s\n", path)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// staleTemps returns the temporary files under dir which are older than
+// minAge and not open in any process known of.
+func staleTemps(dir string, minAge time.Duration, inUse map[string]bool) []string {
+	var paths []string
+	cutoff := time.Now().Add(-minAge)
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		switch {
+		case err != nil:
+			warn("%v", err)
+			return nil
+		case d.IsDir():
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		case !d.Type().IsRegular() || !strings.HasPrefix(d.Name(), tempPrefix):
+			return nil
+		}
+		finfo, err := d.Info()
+		if err != nil || finfo.ModTime().After(cutoff) {
+			return nil
+		}
+		if abs, err := filepath.Abs(path); err == nil && inUse[abs] {
+			warn("%s is still open, leaving it", path)
+			return nil
+		}
+		paths = append(paths, path)
+		return nil
+	})
+	return paths
+}
+
+// openFiles returns the absolute paths of the files held open by running
+// processes. This is only known on Linux, elsewhere the age of temporary
+// files alone decides whether they are stale.
+func openFiles() map[string]bool {
+	open := make(map[string]bool)
+	if runtime.GOOS != "linux" {
+		return open
+	}
+	fds, _ := filepath.Glob("/proc/[0-9]*/fd/*")
+	for _, fd := range fds {
+		if target, err := os.Readlink(fd); err == nil {
+			open[target] = true
+		}
+	}
+	return open
+}
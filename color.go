@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+)
+
+// Colors are only for reading output on a terminal. Colored output cannot
+// be patched, so -color=auto leaves it plain when piped.
+const (
+	colorPath   = "\x1b[35m"
+	colorLineNo = "\x1b[32m"
+	colorMatch  = "\x1b[1;31m"
+	colorReset  = "\x1b[0m"
+)
+
+var colorModes = []string{"auto", "always", "never"}
+
+// useColor decides the -color mode: auto colors output to a terminal,
+// unless NO_COLOR is set.
+func useColor(mode string) bool {
+	switch mode {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return isTerminal(os.Stdout)
+}
+
+func isTerminal(f *os.File) bool {
+	finfo, err := f.Stat()
+	return err == nil && finfo.Mode()&os.ModeCharDevice != 0
+}
+
+// location formats where a record is from: the path and line number, the
+// last line of a span, or the columns of a match. Match records may then
+// have the column of the match, as :C, and its byte offset, as @B. With
+// -heading the path is left out, being above the records. With -hyperlink
+// it is all a link to the line.
+func (s *searchConfig) location(path string, pos recordPos, isMatch bool) string {
+	var nums string
+	switch {
+	case pos.endLine > 0:
+		nums = fmt.Sprintf("%d-%d", pos.lineno, pos.endLine)
+	case pos.cols != nil:
+		// columns count from 1, and the end is just past the match
+		nums = fmt.Sprintf("%d:%d-%d", pos.lineno, pos.cols[0]+1, pos.cols[1]+1)
+	default:
+		nums = fmt.Sprint(pos.lineno)
+	}
+	if isMatch && s.column && pos.cols == nil && pos.column > 0 {
+		nums += fmt.Sprintf(":%d", pos.column)
+	}
+	if isMatch && s.byteOffset {
+		nums += fmt.Sprintf("@%d", pos.offset)
+	}
+	var loc string
+	switch {
+	case s.heading && !s.color:
+		loc = nums
+	case s.heading:
+		loc = colorLineNo + nums + colorReset
+	case !s.color:
+		loc = path + ":" + nums
+	default:
+		loc = colorPath + path + colorReset + ":" + colorLineNo + nums + colorReset
+	}
+	if s.link != nil {
+		column := pos.column
+		if pos.cols != nil {
+			column = pos.cols[0] + 1
+		}
+		loc = s.link.link(path, pos.lineno, column, loc)
+	}
+	return loc
+}
+
+// highlight colors the matches in line, which may be a span of lines.
+// Colors are ended before each newline, so that each line can be printed
+// on its own.
+func (s *searchConfig) highlight(line []byte) []byte {
+	var b bytes.Buffer
+	pos := 0
+	for _, m := range s.lineMatches(line) {
+		b.Write(line[pos:m.idx[0]])
+		for i, seg := range bytes.Split(line[m.idx[0]:m.idx[1]], newline) {
+			if i > 0 {
+				b.WriteByte('\n')
+			}
+			if len(seg) > 0 {
+				b.WriteString(colorMatch)
+				b.Write(seg)
+				b.WriteString(colorReset)
+			}
+		}
+		pos = m.idx[1]
+	}
+	b.Write(line[pos:])
+	return b.Bytes()
+}
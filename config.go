@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The config file holds named search profiles, like:
+//
+//	# comments and blank lines are ignored
+//	[todos]
+//	gredx = .go.py
+//	args = -i -e 'TODO|FIXME'
+//	rule = no-print warning 'fmt\.Print' use the logger instead
+//
+// args are split into words as a shell would, but only with quotes and
+// backslashes, and may be given over several lines. gredx is used in place
+// of the GREDX environment variable. Each rule is an ID, severity, pattern
+// and message, which are reported with matches in -json output.
+type profile struct {
+	name  string
+	gredx *string
+	args  []string
+	rules []*rule
+}
+
+// profileRules are the rules of the profile being run
+var profileRules []*rule
+
+// configPath is $GRED_CONFIG, or else gred/config in the user's config
+// directory.
+func configPath() (string, error) {
+	if path := os.Getenv("GRED_CONFIG"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gred", "config"), nil
+}
+
+func readConfig() (map[string]*profile, error) {
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	profiles := make(map[string]*profile)
+	var prof *profile
+	scan := bufio.NewScanner(f)
+	for lineno := 1; scan.Scan(); lineno++ {
+		line := strings.TrimSpace(scan.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			if profiles[name] != nil {
+				return nil, fmt.Errorf("%s:%d: profile %s is defined twice", path, lineno, name)
+			}
+			prof = &profile{name: name}
+			profiles[name] = prof
+			continue
+		}
+		key, value, ok := cutString(line, "=")
+		if !ok || prof == nil {
+			return nil, fmt.Errorf("%s:%d: expected [profile] or key = value", path, lineno)
+		}
+		switch key = strings.TrimSpace(key); key {
+		case "gredx":
+			value = strings.TrimSpace(value)
+			prof.gredx = &value
+		case "args":
+			words, err := splitWords(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", path, lineno, err)
+			}
+			prof.args = append(prof.args, words...)
+		case "rule":
+			words, err := splitWords(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", path, lineno, err)
+			}
+			r, err := parseRule(words)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", path, lineno, err)
+			}
+			prof.rules = append(prof.rules, r)
+		default:
+			return nil, fmt.Errorf("%s:%d: unknown key %q", path, lineno, key)
+		}
+	}
+	return profiles, scan.Err()
+}
+
+// cutString is strings.Cut, which go 1.17 lacks.
+func cutString(s, sep string) (before, after string, found bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// splitWords splits s at spaces outside of quotes. Backslashes escape the
+// next character, except within single quotes.
+func splitWords(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			word.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, errors.New("unterminated quote or escape")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// runMode searches, or patches, with the named profile's flags and
+// patterns followed by any further args.
+func runMode(args []string) {
+	profiles, err := readConfig()
+	if err != nil {
+		die("%v", err)
+	}
+	if len(args) == 0 {
+		names := make([]string, 0, len(profiles))
+		for name := range profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Println(name)
+		}
+		return
+	}
+	prof := profiles[args[0]]
+	if prof == nil {
+		die("no profile named %s", args[0])
+	}
+	if prof.gredx != nil {
+		os.Setenv("GREDX", *prof.gredx)
+	}
+	profileRules = prof.rules
+	words := append(append([]string(nil), prof.args...), args[1:]...)
+	run(parseFlags(words))
+}
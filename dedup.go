@@ -0,0 +1,58 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// contentDedup picks one file to search of each set with the same content,
+// for -dedup-content. The others are listed with it after searching.
+type contentDedup struct {
+	// seen are the files searched by the hash of their content
+	seen map[[sha256.Size]byte]string
+	// dups are the files left out, for each file searched in their place
+	dups  map[string][]string
+	order []string
+	// matched are the files searched which had matches
+	matched map[string]bool
+}
+
+func newContentDedup() *contentDedup {
+	return &contentDedup{
+		seen:    make(map[[sha256.Size]byte]string),
+		dups:    make(map[string][]string),
+		matched: make(map[string]bool),
+	}
+}
+
+// dup reports whether a file with the same data as path was already
+// searched, and if so lists path with it. Callers hold the searchConfig
+// mutex.
+func (d *contentDedup) dup(path string, data []byte) bool {
+	sum := sha256.Sum256(data)
+	rep, ok := d.seen[sum]
+	if !ok {
+		d.seen[sum] = path
+		return false
+	}
+	if d.dups[rep] == nil {
+		d.order = append(d.order, rep)
+	}
+	d.dups[rep] = append(d.dups[rep], path)
+	return true
+}
+
+// print notes the copies of each file with matches in comments, which
+// patch mode ignores. Patching a file does not patch its copies.
+func (d *contentDedup) print(w io.Writer) {
+	for _, rep := range d.order {
+		if d.matched[rep] {
+			// parallel searches find them in any order
+			sort.Strings(d.dups[rep])
+			fmt.Fprintf(w, "# %s: same content in %s\n", rep, strings.Join(d.dups[rep], ", "))
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// changedLines are the line numbers of each file which were added or
+// modified since a git ref. Paths are relative to the current directory,
+// or absolute with -abs-paths, and cleaned.
+type changedLines map[string]map[int]bool
+
+var hunkHeaderRe = regexp.MustCompile(`^@@ -[0-9]+(?:,[0-9]+)? \+([0-9]+)(?:,([0-9]+))? @@`)
+
+// gitChangedLines runs git diff against ref, for the files under the current
+// directory, and collects the lines it adds.
+func gitChangedLines(ref string, abs bool) (changedLines, error) {
+	cmd := exec.Command("git", "diff", "--no-color", "--no-ext-diff", "--no-prefix", "--relative", "-U0", ref, "--")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git diff %s: %v: %s", ref, err, strings.TrimSpace(stderr.String()))
+	}
+	changed := make(changedLines)
+	var lines map[int]bool
+	scan := bufio.NewScanner(bytes.NewReader(out))
+	scan.Buffer(nil, maxPatchLine)
+	for scan.Scan() {
+		line := scan.Text()
+		switch {
+		case strings.HasPrefix(line, "+++ "):
+			path := strings.TrimPrefix(line, "+++ ")
+			if path == "/dev/null" {
+				lines = nil
+				continue
+			}
+			// git quotes unusual paths, which are then unquoted
+			if uq, err := strconv.Unquote(path); err == nil {
+				path = uq
+			}
+			path = filepath.Clean(filepath.FromSlash(path))
+			if abs {
+				if path, err = filepath.Abs(path); err != nil {
+					return nil, err
+				}
+			}
+			lines = make(map[int]bool)
+			changed[path] = lines
+		case lines != nil && strings.HasPrefix(line, "@@"):
+			m := hunkHeaderRe.FindStringSubmatch(line)
+			if m == nil {
+				return nil, fmt.Errorf("git diff %s: bad hunk header %q", ref, line)
+			}
+			start, _ := strconv.Atoi(m[1])
+			n := 1
+			if m[2] != "" {
+				n, _ = strconv.Atoi(m[2])
+			}
+			for i := start; i < start+n; i++ {
+				lines[i] = true
+			}
+		}
+	}
+	return changed, scan.Err()
+}
+
+// gitTrackedFiles runs git ls-files for the files under the current
+// directory, returning them and the directories above them, relative to
+// it or absolute as gitChangedLines does.
+func gitTrackedFiles(abs bool) (map[string]bool, error) {
+	out, err := gitOutput("ls-files", "-z", "--cached", "--")
+	if err != nil {
+		return nil, err
+	}
+	tracked := make(map[string]bool)
+	for _, path := range strings.Split(string(out), "\x00") {
+		if path == "" {
+			continue
+		}
+		path = filepath.Clean(filepath.FromSlash(path))
+		if abs {
+			if path, err = filepath.Abs(path); err != nil {
+				return nil, err
+			}
+		}
+		for ; !tracked[path]; path = filepath.Dir(path) {
+			tracked[path] = true
+		}
+	}
+	return tracked, nil
+}
+
+// has reports whether the line of path was changed. Any line of a path
+// which was not changed at all is not.
+func (c changedLines) has(path string, lineno int) bool {
+	return c[filepath.Clean(path)][lineno]
+}
+
+// hasAny reports whether any line of path from lineno to endLine was
+// changed. endLine may be 0 for just lineno.
+func (c changedLines) hasAny(path string, lineno, endLine int) bool {
+	for n := lineno; n == lineno || n <= endLine; n++ {
+		if c.has(path, n) {
+			return true
+		}
+	}
+	return false
+}
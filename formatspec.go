@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// textFormatID is the version of the text format of search output, which
+// patch mode reads. Like the schema IDs of -json, it only changes when
+// records change incompatibly.
+const textFormatID = "gred/text/v1"
+
+// recordLayout is the layout of a record, the parts in brackets being added
+// by some flags.
+const recordLayout = "SEP CRC[:ABOVE:BELOW] TAB PATH:LINE[-END][:COL-COLEND][:COLUMN][@OFFSET] TAB TEXT"
+
+// lineKinds are the kinds of search output line, in the order GRED_SEP
+// gives their separators.
+var lineKinds = []struct {
+	sep          rune
+	kind, layout string
+	patched      bool
+	desc         string
+}{
+	{firstSepLeft, "first", recordLayout, true, "the first match line of a file"},
+	{crcSepLeft, "match", recordLayout, true, "a later match line"},
+	{passSepLeft, "passthru", recordLayout, true, "a line printed by -passthru"},
+	{anchorSepLeft, "context", recordLayout, true, "a context line, from -A, -B, -C or -hunk"},
+	{funcSepLeft, "function", recordLayout, true, "a -show-function line"},
+	{spanSepLeft, "span", "SEP TAB TEXT", true, "a later line of a -multiline match, SEP TAB TEXT"},
+	{headingSepLeft, "heading", "SEP TAB PATH", false, "a -heading line, SEP TAB PATH, which is ignored"},
+	{trailerSepLeft, "trailer", "SEP gred TAB FIELD=VALUE ...", false,
+		"a -trailer line, SEP gred TAB FIELDS, which is ignored"},
+}
+
+// formatSpec describes the text format for tools which read or write it, as
+// gred format-spec -json prints it.
+type formatSpec struct {
+	Format       string            `json:"format"`
+	Record       string            `json:"record"`
+	PrefixRegexp string            `json:"prefix_regexp"`
+	Separators   []formatSeparator `json:"separators"`
+	CRC          formatCRC         `json:"crc"`
+	Ignored      []string          `json:"ignored"`
+	Escaping     map[string]string `json:"escaping"`
+	JSONSchemas  []string          `json:"json_schemas"`
+}
+
+// formatSeparator gives the separators of a kind of line, printed being
+// that of -ascii or GRED_SEP now.
+type formatSeparator struct {
+	Kind    string `json:"kind"`
+	Box     string `json:"box"`
+	ASCII   string `json:"ascii"`
+	Printed string `json:"printed"`
+	Layout  string `json:"layout"`
+	Patched bool   `json:"patched"`
+}
+
+type formatCRC struct {
+	Algorithm string `json:"algorithm"`
+	Encoding  string `json:"encoding"`
+	Length    int    `json:"length"`
+	None      string `json:"none"`
+}
+
+// formatSpecMode prints the text format of search output and patch input,
+// or with -json the formatSpec.
+func formatSpecMode(args []string) {
+	if len(args) != 0 {
+		warn("format-spec does not accept arguments")
+		usage()
+	}
+	if !*jsonFlag {
+		fmt.Printf("%s\n\n%s\nPatch mode reads the prefix of each record up to TEXT with the regexp:\n\t%s\n",
+			textFormatID, formatHelp(), patchPrefixRe)
+		return
+	}
+	spec := formatSpec{
+		Format:       textFormatID,
+		Record:       recordLayout,
+		PrefixRegexp: patchPrefixRe.String(),
+		CRC: formatCRC{
+			Algorithm: "CRC-32 (IEEE) of the line without its newline",
+			Encoding:  "ASCII85 of the checksum's 4 big-endian bytes",
+			Length:    len(crcBytes(nil)),
+			None:      string(anchorCRC(nil)),
+		},
+		Ignored: []string{"blank lines", "lines beginning with #", "heading lines", "trailer lines"},
+		Escaping: map[string]string{
+			"records":    "each record ends with a newline, or with -z a NUL",
+			"nul":        `with -z, backslashes are escaped as \\ and newlines as \n in paths and text`,
+			"multiline":  "a -multiline match is its first line, then a span line for each line after",
+			"paths":      "PATH holds no tab, nor any colon but that of a Windows drive letter",
+			"separators": "patch mode reads the box and ASCII separators, and those of GRED_SEP",
+		},
+		JSONSchemas: []string{matchSchemaID, patchSchemaID},
+	}
+	for _, k := range lineKinds {
+		spec.Separators = append(spec.Separators, formatSeparator{
+			Kind:    k.kind,
+			Box:     string(boxSeps.of(k.sep)),
+			ASCII:   string(asciiSeps.of(k.sep)),
+			Printed: string(seps.of(k.sep)),
+			Layout:  k.layout,
+			Patched: k.patched,
+		})
+	}
+	printJSON(os.Stdout, spec)
+}
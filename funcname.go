@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const funcSepLeft = '╟'
+
+var (
+	defaultFuncRe = regexp.MustCompile(`^[[:alpha:]$_]`)
+	funcRes       = map[string]*regexp.Regexp{}
+)
+
+func init() {
+	langs := []struct {
+		exts string
+		re   string
+	}{
+		{".go", `^(func|type)\s`},
+		{".py", `^\s*(async\s+)?(def|class)\s`},
+		{".rb", `^\s*(def|class|module)\s`},
+		{".rs", `^\s*(pub(\(\w+\))?\s+)?(async\s+)?(fn|struct|enum|impl|trait|mod)\s`},
+		{".js.jsx.ts.tsx.mjs", `^\s*(export\s+)?(default\s+)?(async\s+)?(function|class)\b`},
+		{".java.kt.cs.scala", `^\s*(\w+\s+)*(class|interface|enum|record|object|fun)\s|` +
+			`^\s*((public|private|protected|static|final|abstract|override|internal)\s+)+[\w<>\[\],]+\s+\w+\s*\(`},
+		{".c.h.cc.cpp.hpp.cxx", `^[[:alpha:]_][^;]*\([^;]*$`},
+		{".sh.bash.zsh", `^\s*(function\s+\w+|\w+\s*\(\)\s*\{?)`},
+		{".md.markdown", `^#{1,6}\s`},
+		{".ini.toml.cfg", `^\s*\[`},
+	}
+	for _, l := range langs {
+		re := regexp.MustCompile(l.re)
+		for _, ext := range strings.Split(l.exts[1:], ".") {
+			funcRes["."+ext] = re
+		}
+	}
+}
+
+// funcRegexp returns the regexp matching function or section header lines
+// for path, based upon its file extension.
+func funcRegexp(path string) *regexp.Regexp {
+	if re, ok := funcRes[strings.ToLower(filepath.Ext(path))]; ok {
+		return re
+	}
+	return defaultFuncRe
+}
+
+// funcContext searches up to limit lines backwards from the end of buf for
+// a line matching re. buf must end just after a newline. Returns the line
+// found and how many lines above the end of buf it is.
+func funcContext(re *regexp.Regexp, buf []byte, limit int) ([]byte, int) {
+	for back := 1; back <= limit && len(buf) > 0; back++ {
+		end := len(buf) - 1
+		i := 1 + bytes.LastIndexByte(buf[:end], '\n')
+		if line := buf[i:end]; re.Match(line) {
+			return line, back
+		}
+		buf = buf[:i]
+	}
+	return nil, 0
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ignoreFiles are the files of ignore rules read in each directory, the
+// .gredignore after the .gitignore so that its rules override. Projects
+// which are not git repositories, or which exclude more from searches than
+// from git, may give theirs in .gredignore files.
+var ignoreFiles = []string{".gitignore", ".gredignore"}
+
+// gitIgnores holds the ignore files of the directories walked, read as the
+// walk reaches them, so that the files git ignores, such as build output
+// and node_modules, are not searched. Like git, the rules of a directory's
+// ignore files apply below it, and those of deeper directories override
+// those above them. Those of the directories above the current one apply
+// too, up to the top of its git repository.
+type gitIgnores struct {
+	// byDir is nil for directories without ignore files
+	byDir map[string][]ignoreRule
+	// above are those of the directories above, nearest first
+	above []outerIgnores
+}
+
+// outerIgnores are the rules of the ignore files of a directory above the
+// current one, which is at prefix below it.
+type outerIgnores struct {
+	prefix string
+	rules  []ignoreRule
+}
+
+// An ignoreRule is one line of an ignore file, matched against the slashed
+// path relative to its directory. Negated rules include files excluded by
+// the rules before them again, and dirOnly rules only match directories.
+type ignoreRule struct {
+	re               *regexp.Regexp
+	negated, dirOnly bool
+	// from is the name of the ignore file
+	from string
+}
+
+func newGitIgnores() *gitIgnores {
+	g := &gitIgnores{byDir: make(map[string][]ignoreRule)}
+	dir, err := os.Getwd()
+	if err != nil {
+		return g
+	}
+	prefix := ""
+	for !isRepoTop(dir) {
+		up := filepath.Dir(dir)
+		if up == dir {
+			// not in a repository, so nothing above applies
+			g.above = nil
+			break
+		}
+		prefix = filepath.Base(dir) + "/" + prefix
+		dir = up
+		if rules := g.rules(dir); rules != nil {
+			g.above = append(g.above, outerIgnores{prefix, rules})
+		}
+	}
+	return g
+}
+
+// isRepoTop reports whether dir is the top of a git repository, holding
+// its .git directory, or the file naming it in worktrees and submodules.
+func isRepoTop(dir string) bool {
+	_, err := os.Lstat(filepath.Join(dir, ".git"))
+	return err == nil
+}
+
+// rules returns the rules of the ignore files in dir, reading them the
+// first time. Unreadable files are taken to have none.
+func (g *gitIgnores) rules(dir string) []ignoreRule {
+	if rules, ok := g.byDir[dir]; ok {
+		return rules
+	}
+	var rules []ignoreRule
+	for _, name := range ignoreFiles {
+		f, err := os.Open(longPath(filepath.Join(dir, name)))
+		if err != nil {
+			continue
+		}
+		scan := bufio.NewScanner(f)
+		for scan.Scan() {
+			if r, ok := parseIgnoreRule(scan.Text()); ok {
+				r.from = name
+				rules = append(rules, r)
+			}
+		}
+		f.Close()
+	}
+	g.byDir[dir] = rules
+	return rules
+}
+
+// ignored returns the name of the ignore file which ignores path, a
+// directory if dir, among those of the directories above it, or "" if none
+// do. A nil gitIgnores ignores nothing.
+func (g *gitIgnores) ignored(path string, dir bool) string {
+	if g == nil {
+		return ""
+	}
+	dirs := ancestors(filepath.Dir(path))
+	// the deepest .gitignore with a rule matching decides
+	for i := len(dirs) - 1; i >= 0; i-- {
+		rel := path
+		if dirs[i] != "." {
+			rel = path[len(dirs[i])+1:]
+		}
+		if r := matchIgnores(g.rules(dirs[i]), filepath.ToSlash(rel), dir); r != nil {
+			return ignoredBy(r)
+		}
+	}
+	if dirs[0] != "." {
+		return ""
+	}
+	for _, outer := range g.above {
+		if r := matchIgnores(outer.rules, outer.prefix+filepath.ToSlash(path), dir); r != nil {
+			return ignoredBy(r)
+		}
+	}
+	return ""
+}
+
+// matchIgnores returns the last of rules to match rel, or nil if none do.
+func matchIgnores(rules []ignoreRule, rel string, dir bool) *ignoreRule {
+	var last *ignoreRule
+	for i, r := range rules {
+		if (!r.dirOnly || dir) && r.re.MatchString(rel) {
+			last = &rules[i]
+		}
+	}
+	return last
+}
+
+// ignoredBy returns the ignore file of r if it ignores, and "" if it is a
+// negated rule including files again.
+func ignoredBy(r *ignoreRule) string {
+	if r.negated {
+		return ""
+	}
+	return r.from
+}
+
+// ancestors returns dir and the directories above it, outermost first,
+// beginning with . for relative paths within the current directory.
+func ancestors(dir string) []string {
+	dir = filepath.Clean(dir)
+	if dir == "." {
+		return []string{"."}
+	}
+	var dirs []string
+	for d := dir; ; d = filepath.Dir(d) {
+		dirs = append(dirs, d)
+		if up := filepath.Dir(d); up == d || up == "." {
+			break
+		}
+	}
+	if filepath.IsAbs(dir) || dir == ".." || strings.HasPrefix(dir, ".."+string(filepath.Separator)) {
+		// there is no . above them, and no .gitignore above the root
+	} else {
+		dirs = append(dirs, ".")
+	}
+	for i, j := 0, len(dirs)-1; i < j; i, j = i+1, j-1 {
+		dirs[i], dirs[j] = dirs[j], dirs[i]
+	}
+	return dirs
+}
+
+// parseIgnoreRule parses a line of an ignore file, reporting false for blank
+// lines and comments.
+func parseIgnoreRule(line string) (ignoreRule, bool) {
+	var r ignoreRule
+	line = strings.TrimSuffix(line, "\r")
+	// trailing spaces are dropped unless escaped
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	switch {
+	case line == "" || line[0] == '#':
+		return r, false
+	case line[0] == '!':
+		r.negated, line = true, line[1:]
+	case line[0] == '\\':
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly, line = true, strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return r, false
+	}
+	// a slash before the end anchors the rule to the directory, otherwise
+	// it matches names at any depth
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	expr := "^"
+	if !anchored {
+		expr += "(?:.*/)?"
+	}
+	expr += ignoreGlobRegexp(line) + "$"
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return r, false
+	}
+	r.re = re
+	return r, true
+}
+
+// ignoreGlobRegexp translates an ignore file glob into a regexp, where ** may
+// match across directories and other wildcards only within a name.
+func ignoreGlobRegexp(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "/**") && i+3 == len(glob):
+			b.WriteString("/.*")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"reflect"
+	"sort"
+)
+
+// goPattern matches Go expressions by their syntax trees for -go-ast, like
+// gofmt -r: single lowercase letter identifiers in the pattern are
+// wildcards, matching any expression, and a wildcard used twice must match
+// the same expression both times. The matched lines are printed as usual,
+// so they can be edited and patched back.
+type goPattern struct {
+	pat ast.Expr
+	// repl is the -replace template, where the wildcards stand for the
+	// source of the expressions they matched, or nil
+	repl *goTemplate
+}
+
+// goTemplate is the source of a replacement expression, with the offsets of
+// the wildcards in it.
+type goTemplate struct {
+	src       []byte
+	wildcards []goWildcard
+}
+
+type goWildcard struct {
+	name       string
+	start, end int
+	id         *ast.Ident
+	// parent is the expression the wildcard is in, or nil
+	parent ast.Node
+}
+
+// needsParens reports whether the source of expr, put in place of the
+// wildcard, would bind differently without parentheses.
+func (wc goWildcard) needsParens(expr ast.Expr) bool {
+	bin, ok := expr.(*ast.BinaryExpr)
+	if !ok {
+		// operands bind tighter than any operator
+		return false
+	}
+	switch p := wc.parent.(type) {
+	case *ast.BinaryExpr:
+		prec := p.Op.Precedence()
+		// operators of the same precedence are left associative
+		right := p.Y == ast.Expr(wc.id)
+		return bin.Op.Precedence() < prec || (bin.Op.Precedence() == prec && right)
+	case *ast.UnaryExpr, *ast.StarExpr:
+		return true
+	case *ast.SelectorExpr, *ast.IndexExpr, *ast.SliceExpr, *ast.TypeAssertExpr:
+		return true
+	case *ast.CallExpr:
+		return p.Fun == ast.Expr(wc.id)
+	}
+	return false
+}
+
+func newGoPattern(expr string, repl []byte) (*goPattern, error) {
+	pat, err := parser.ParseExpr(expr)
+	if err != nil {
+		return nil, fmt.Errorf("-go-ast: %v", err)
+	}
+	g := &goPattern{pat: pat}
+	if repl != nil {
+		if g.repl, err = newGoTemplate(repl); err != nil {
+			return nil, fmt.Errorf("-replace: %v", err)
+		}
+	}
+	return g, nil
+}
+
+func newGoTemplate(src []byte) (*goTemplate, error) {
+	fset := token.NewFileSet()
+	expr, err := parser.ParseExprFrom(fset, "", src, 0)
+	if err != nil {
+		return nil, err
+	}
+	t := &goTemplate{src: src}
+	var parents []ast.Node
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if n == nil {
+			parents = parents[:len(parents)-1]
+			return true
+		}
+		if id, ok := n.(*ast.Ident); ok && isGoWildcard(id.Name) {
+			start := fset.Position(id.Pos()).Offset
+			wc := goWildcard{name: id.Name, start: start, end: start + len(id.Name), id: id}
+			if len(parents) > 0 {
+				wc.parent = parents[len(parents)-1]
+			}
+			t.wildcards = append(t.wildcards, wc)
+		}
+		parents = append(parents, n)
+		return true
+	})
+	return t, nil
+}
+
+func isGoWildcard(name string) bool {
+	return len(name) == 1 && 'a' <= name[0] && name[0] <= 'z'
+}
+
+// goMatch is an expression matched in a file, by byte offsets, with the
+// expressions its wildcards matched.
+type goMatch struct {
+	start, end int
+	binds      map[string]ast.Expr
+}
+
+// find returns the outermost expressions of file matching the pattern, in
+// order. Expressions within a match are not matched again.
+func (g *goPattern) find(file *ast.File, fset *token.FileSet) []goMatch {
+	var ms []goMatch
+	pat := reflect.ValueOf(g.pat)
+	ast.Inspect(file, func(n ast.Node) bool {
+		expr, ok := n.(ast.Expr)
+		if !ok {
+			return true
+		}
+		binds := make(map[string]reflect.Value)
+		if !goMatchValue(binds, pat, reflect.ValueOf(expr)) {
+			return true
+		}
+		m := goMatch{
+			start: fset.Position(expr.Pos()).Offset,
+			end:   fset.Position(expr.End()).Offset,
+			binds: make(map[string]ast.Expr, len(binds)),
+		}
+		for name, v := range binds {
+			m.binds[name] = v.Interface().(ast.Expr)
+		}
+		ms = append(ms, m)
+		return false
+	})
+	sort.Slice(ms, func(i, j int) bool { return ms[i].start < ms[j].start })
+	return ms
+}
+
+var (
+	goIdentType  = reflect.TypeOf((*ast.Ident)(nil))
+	goCallType   = reflect.TypeOf((*ast.CallExpr)(nil))
+	goPosType    = reflect.TypeOf(token.NoPos)
+	goObjectType = reflect.TypeOf((*ast.Object)(nil))
+	goScopeType  = reflect.TypeOf((*ast.Scope)(nil))
+	goExprType   = reflect.TypeOf((*ast.Expr)(nil)).Elem()
+)
+
+// goMatchValue reports whether val matches the pattern, as gofmt's rewrite
+// does. Wildcards are bound in binds, unless it is nil when comparing the
+// expressions bound to a wildcard used twice. Positions and the objects
+// resolved by the parser are ignored, but for whether a call passes its
+// last argument with ..., which only its position says.
+func goMatchValue(binds map[string]reflect.Value, pattern, val reflect.Value) bool {
+	if binds != nil && pattern.IsValid() && pattern.Type() == goIdentType && !pattern.IsNil() {
+		name := pattern.Interface().(*ast.Ident).Name
+		if isGoWildcard(name) && val.IsValid() && val.Type().Implements(goExprType) && !val.IsNil() {
+			if old, ok := binds[name]; ok {
+				return goMatchValue(nil, old, val)
+			}
+			binds[name] = val
+			return true
+		}
+	}
+	if !pattern.IsValid() || !val.IsValid() {
+		return !pattern.IsValid() && !val.IsValid()
+	}
+	if pattern.Type() != val.Type() {
+		return false
+	}
+	switch pattern.Type() {
+	case goPosType, goObjectType, goScopeType:
+		return true
+	case goIdentType:
+		if pattern.IsNil() || val.IsNil() {
+			return pattern.IsNil() && val.IsNil()
+		}
+		return pattern.Interface().(*ast.Ident).Name == val.Interface().(*ast.Ident).Name
+	case goCallType:
+		if !pattern.IsNil() && !val.IsNil() &&
+			pattern.Interface().(*ast.CallExpr).Ellipsis.IsValid() != val.Interface().(*ast.CallExpr).Ellipsis.IsValid() {
+			return false
+		}
+	}
+	p, v := reflect.Indirect(pattern), reflect.Indirect(val)
+	if !p.IsValid() || !v.IsValid() {
+		return !p.IsValid() && !v.IsValid()
+	}
+	switch p.Kind() {
+	case reflect.Slice:
+		if p.Len() != v.Len() {
+			return false
+		}
+		for i := 0; i < p.Len(); i++ {
+			if !goMatchValue(binds, p.Index(i), v.Index(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Struct:
+		for i := 0; i < p.NumField(); i++ {
+			if !goMatchValue(binds, p.Field(i), v.Field(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Interface:
+		return goMatchValue(binds, p.Elem(), v.Elem())
+	}
+	return p.Interface() == v.Interface()
+}
+
+// expand writes the template with each wildcard replaced by the source of
+// the expression it matched in data, in parentheses where it would
+// otherwise bind differently.
+func (t *goTemplate) expand(data []byte, fset *token.FileSet, m goMatch) []byte {
+	var b bytes.Buffer
+	pos := 0
+	for _, wc := range t.wildcards {
+		b.Write(t.src[pos:wc.start])
+		pos = wc.end
+		expr, ok := m.binds[wc.name]
+		if !ok {
+			// a wildcard the pattern did not have stays as it is
+			b.WriteString(wc.name)
+			continue
+		}
+		src := data[fset.Position(expr.Pos()).Offset:fset.Position(expr.End()).Offset]
+		if wc.needsParens(expr) {
+			b.WriteByte('(')
+			b.Write(src)
+			b.WriteByte(')')
+		} else {
+			b.Write(src)
+		}
+	}
+	b.Write(t.src[pos:])
+	return b.Bytes()
+}
+
+// grepGoAST prints the lines of the Go source in data with expressions
+// matching s.goAST. Lines with several matches are printed once, and lines
+// of matches spanning lines together with -replace or -multiline. first and
+// count are as in grep.
+func (s *searchConfig) grepGoAST(w io.Writer, path string, data []byte, first *bool, count *int) error {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, data, parser.ParseComments)
+	if err != nil {
+		return err
+	}
+	ms := s.goAST.find(file, fset)
+	for len(ms) > 0 {
+		// a region is the lines of matches which share lines
+		start := bytes.LastIndexByte(data[:ms[0].start], '\n') + 1
+		end, k := lineEnd(data, ms[0].end), 1
+		for k < len(ms) && ms[k].start < end {
+			if e := lineEnd(data, ms[k].end); e > end {
+				end = e
+			}
+			k++
+		}
+		region := ms[:k]
+		ms = ms[k:]
+		if !s.takeMatch(*count) {
+			return nil
+		}
+		if s.printGoRegion(w, *first, path, data, fset, start, end, region) {
+			*first = false
+			*count++
+		} else {
+			s.returnMatch()
+		}
+	}
+	return nil
+}
+
+// lineEnd returns the offset of the newline ending the line with offset i,
+// or the end of data.
+func lineEnd(data []byte, i int) int {
+	if i > 0 && i <= len(data) && data[i-1] == '\n' {
+		i--
+	}
+	if j := bytes.IndexByte(data[i:], '\n'); j >= 0 {
+		return i + j
+	}
+	return len(data)
+}
+
+// printGoRegion prints the lines of data from start to end, which hold the
+// matches of region, and reports whether they were printed.
+func (s *searchConfig) printGoRegion(w io.Writer, first bool, path string, data []byte, fset *token.FileSet, start, end int, region []goMatch) bool {
+	text := data[start:end]
+	lineno := bytes.Count(data[:start], newline) + 1
+	endLine := 0
+	if n := bytes.Count(text, newline); n > 0 {
+		endLine = lineno + n
+	}
+	if !s.admit(path, lineno, endLine, text) {
+		return false
+	}
+	if endLine > 0 && s.goAST.repl == nil && !s.multiline {
+		// print each line of the matches, as a regexp's lines are
+		for i, line := range bytes.Split(text, newline) {
+			pos := recordPos{lineno: lineno + i, offset: start}
+			if i == 0 {
+				pos.column = region[0].start - start + 1
+			}
+			s.printGoLine(w, first && i == 0, path, pos, line, data, nil)
+			start += len(line) + 1
+		}
+		return true
+	}
+	pos := recordPos{lineno: lineno, endLine: endLine, column: region[0].start - start + 1, offset: start}
+	var repl []byte
+	if s.goAST.repl != nil {
+		prev := start
+		for _, m := range region {
+			repl = append(repl, data[prev:m.start]...)
+			repl = append(repl, s.goAST.repl.expand(data, fset, m)...)
+			prev = m.end
+		}
+		repl = append(repl, data[prev:end]...)
+	}
+	s.printGoLine(w, first, path, pos, text, data, repl)
+	return true
+}
+
+// printGoLine prints the line, or span of lines, at pos.offset in data, or
+// repl in its place when it is not nil.
+func (s *searchConfig) printGoLine(w io.Writer, first bool, path string, pos recordPos, line, data, repl []byte) {
+	var aboveCRC, belowCRC []byte
+	if s.anchor {
+		above, below := linesAround(data, pos.offset, pos.offset+len(line))
+		aboveCRC, belowCRC = anchorCRC(above), anchorCRC(below)
+	}
+	crc := crcBytes(line)
+	if repl != nil {
+		line = repl
+	}
+	s.printRecord(w, first, crcSepLeft, path, pos, line, crc, aboveCRC, belowCRC)
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestGoASTEllipsis checks that a call passing its last argument with ...
+// only matches a pattern which does too, and keeps it when replaced.
+func TestGoASTEllipsis(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a.go": "package a\n\nfunc f(xs, ys []int) {\n\txs = append(xs, ys...)\n\txs = append(xs, 1)\n}\n",
+	})
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-go-ast", "append(a, b)"}, "╓$@6J'\ta.go:5\t\txs = append(xs, 1)\n"},
+		{[]string{"-go-ast", "append(a, b...)"}, "╓O-92j\ta.go:4\t\txs = append(xs, ys...)\n"},
+		{[]string{"-go-ast", "append(a, b)", "-replace", "push(a, b)"}, "╓$@6J'\ta.go:5\t\txs = push(xs, 1)\n"},
+		{[]string{"-go-ast", "append(a, b...)", "-replace", "push(a, b...)"}, "╓O-92j\ta.go:4\t\txs = push(xs, ys...)\n"},
+	}
+	for _, tt := range tests {
+		r := runGred(t, dir, "", nil, append(tt.args, "@a.go")...)
+		if r.code != 0 || r.stdout != tt.want {
+			t.Errorf("gred %s: exit %d, printed %q, want %q\n%s", strings.Join(tt.args, " "), r.code, r.stdout, tt.want, r.stderr)
+		}
+	}
+}
@@ -1,17 +1,137 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"strings"
+	"time"
 )
 
 var (
-	patchFlag = flag.Bool("p", false, "patch mode: feed in edited gred match output")
+	patchFlag          = flag.Bool("p", false, "patch mode: feed in edited gred match output")
+	simulateFlag       = flag.String("simulate", "", "with -p, write patched files under `DIR` and leave the originals")
+	followFlag         = flag.Bool("follow-symlinks", true, "with -p, patch the files symlinks point to, or else refuse to patch symlinks")
+	forceReadOnlyFlag  = flag.Bool("force-readonly", false, "with -p, patch read-only files too, leaving them read-only, rather than refusing to")
+	maxLineFlag        = flag.Int("max-line", maxPatchLine, "the longest patch input line in `BYTES`, or line of a large file searched")
+	orderFlag          = flag.String("order", "stream", "with -p, patch files in order: stream (as input), path (natural order), or size (smallest first)")
+	patchDelayFlag     = flag.Duration("patch-delay", 0, "with -p, wait `DURATION` between patching files, for watchers to react to each")
+	tempDirFlag        = flag.String("tempdir", "", "with -p, write patched files in `DIR` before they replace the originals, or with system in TMPDIR")
+	progressFlag       = flag.Duration("progress", 5*time.Second, "with -p, report the files patched and time left to stderr every `DURATION`, 0 for never")
+	inPlaceFlag        = flag.Bool("in-place", false, "with -p, write patched files back over the originals, keeping their inodes and hard links, rather than renaming over them")
+	strictFlag         = flag.Bool("strict", false, "with -p, refuse to patch files which shrank since they were searched, rather than looking for the lines moved")
+	skipBadLinesFlag   = flag.Bool("skip-bad-lines", false, "with -p, warn of patch lines which cannot be parsed and leave them out, rather than patching nothing")
+	tuiFlag            = flag.Bool("tui", false, "list the match lines found to edit or turn off on the terminal, then patch them")
+	serveFlag          = flag.String("serve", "", "serve searches and patches as JSON over HTTP at `ADDR`, such as :8080 on localhost, see the usage")
+	selectFlag         = flag.Bool("select", false, "with -p, choose which of the files to patch before applying")
+	presetFlag         = flag.String("preset", "", "search for the patterns of a built-in rule pack `NAME`, see gred preset")
+	fixedFlag          = flag.Bool("F", false, "match patterns as fixed strings rather than regexps")
+	ignoreCaseFlag     = flag.Bool("i", false, "match patterns ignoring case")
+	smartCaseFlag      = flag.Bool("smart-case", false, "ignore case unless a pattern has an uppercase letter")
+	wordFlag           = flag.Bool("w", false, "only match patterns at word boundaries")
+	sampleFlag         = flag.Int("sample", 0, "print at most `N` randomly chosen matches of each pattern, with the count of all")
+	nulFlag            = flag.Bool("z", false, "end search output records with NUL, escaping newlines and backslashes; with -p, read them")
+	columnFlag         = flag.Bool("column", false, "add the column of the first match to match lines, as path:line:column")
+	byteOffsetFlag     = flag.Bool("byte-offset", false, "add the byte offset in the file of match lines, or of matches with -o, as @offset")
+	colorFlag          = flag.String("color", "auto", "highlight matches: auto (on a terminal), always, or never; colored output cannot be patched")
+	hyperlinkFlag      = flag.Bool("hyperlink", false, "on a terminal, make paths OSC 8 links to the URL template GRED_HYPERLINK, or file://{host}{path}")
+	multilineFlag      = flag.Bool("multiline", false, "print a match across lines as one record, which patch mode replaces as a whole")
+	goASTFlag          = flag.String("go-ast", "", "match the Go `EXPR` by syntax, with single lowercase letters as wildcards as in gofmt -r")
+	onlyMatchingFlag   = flag.Bool("o", false, "print only the matched text of lines, with its columns, which patch mode also accepts")
+	lineFlag           = flag.Bool("x", false, "only match patterns against whole lines")
+	normFlag           = flag.Bool("norm", false, "match composed (NFC) and decomposed (NFD) accented letters alike")
+	byLineFlag         = flag.Bool("by-line", false, "match patterns against each line, so ^ and $ anchor lines as in grep")
+	showFuncFlag       = flag.Bool("show-function", false, "show the enclosing function or section line above matches")
+	passthruFlag       = flag.Bool("passthru", false, "print every line of files with matches, marking the matched lines")
+	replaceFlag        = flag.String("replace", "", "output an edit stream with matches replaced (may use $1 etc.)")
+	previewFlag        = flag.Bool("preview", false, "with -replace, preview original and replaced lines instead")
+	hunkFlag           = flag.Int("hunk", 0, "print `N` anchor lines around matches, verified by patch mode")
+	afterFlag          = flag.Int("A", 0, "print `N` context lines after matches, which may be edited too")
+	beforeFlag         = flag.Int("B", 0, "print `N` context lines before matches, which may be edited too")
+	contextFlag        = flag.Int("C", 0, "print `N` context lines around matches, like -hunk")
+	anchorFlag         = flag.Bool("anchor", false, "add the CRCs of neighbouring lines to matches, verified by patch mode")
+	uniqueFlag         = flag.Bool("unique", false, "print each distinct matched line once with its match count")
+	quietFlag          = flag.Bool("q", false, "print nothing and stop at the first match, for the exit status alone")
+	asciiFlag          = flag.Bool("ascii", false, "begin search output lines with ASCII separators, as GRED_SEP=ascii does")
+	headingFlag        = flag.Bool("heading", false, "print each path once, above its records, rather than on every line")
+	absPathsFlag       = flag.Bool("abs-paths", false, "print absolute paths, so output from different directories can be patched together")
+	rootFlag           = flag.String("root", "", "search from `DIR` and print paths relative to it; patch paths are also relative to it")
+	timeoutFlag        = flag.Duration("file-timeout", 0, "give up searching a file after `DURATION`, e.g. 2s")
+	whySkippedFlag     = flag.Bool("why-skipped", false, "list the files and directories skipped and why, after searching")
+	diffOnlyFlag       = flag.String("diff-only", "", "only report matches on lines added or changed since the git `REF`")
+	revFlag            = flag.String("rev", "", "search the files as they were at the git `REV`, or in each commit of a range A..B changing their matches")
+	trackedFlag        = flag.Bool("tracked", false, "only search files tracked by git, leaving out untracked scratch files and build output")
+	baselineFlag       = flag.String("baseline", "", "only report matches which are not in the baseline `FILE`")
+	updateBaselineFlag = flag.Bool("update-baseline", false, "with -baseline, record every match found in the baseline file")
+	blameFlag          = flag.Bool("blame", false, "note who last changed each match line, from git blame, in a comment above it")
+	maxCountFlag       = flag.Int("m", 0, "stop searching a file after `N` match lines")
+	firstFlag          = flag.Int("first", 0, "print only the first `N` match lines of each file, like -m")
+	lastFlag           = flag.Int("last", 0, "print only the last `N` match lines of each file")
+	maxTotalFlag       = flag.Int("max-total", 0, "stop searching after `N` match lines in all")
+	dedupFlag          = flag.Bool("dedup-content", false, "search one of each set of files with the same content, listing the others after")
+	ownersFlag         = flag.Bool("owners", false, "note the CODEOWNERS of each file with matches in a comment above them")
+	groupByFlag        = flag.String("group-by", "", "end with a count of matches for each `owner` in CODEOWNERS")
+	jsonFlag           = flag.Bool("json", false, "print search output and patch reports as JSON lines, see gred schema")
+	trailerFlag        = flag.Bool("trailer", false, "end search output with a record of how it was made, ignored by patch mode")
+	errorsFlag         = flag.String("errors", "continue", "on file errors: continue (with a warning), abort, or quiet")
+	jobsFlag           = flag.Int("j", 1, "search `N` files at once, printing each in order as soon as it can be")
+	mmapFlag           = flag.Bool("mmap", false, "map files searched into memory rather than reading them, unless small or not regular files")
+	ioLimitFlag        = flag.String("io-limit", "", "read files searched at no more than `RATE` bytes per second, e.g. 10M")
+	relocateFlag       = flag.String("relocate", "nearby", "with -p, where to look for lines which moved: off, nearby (anchored lines only), or global (if unique)")
+	collapseFlag       = flag.Int("collapse", 0, "group files by directory, collapsing those with more than `N` matches into a comment")
+	rankFlag           = flag.Bool("rank", false, "print files by relevance: dense and recently modified matches first")
+	unorderedFlag      = flag.Bool("unordered", false, "walk directories unsorted and, with -j, print files as they are searched, for speed")
+	noIgnoreFlag       = flag.Bool("no-ignore", false, "search files ignored by .gitignore and .gredignore files too")
+	noIndexFlag        = flag.Bool("no-index", false, "search every file, rather than only those the index made by gred index may match")
+	noCacheFlag        = flag.Bool("no-cache", false, "search every file again, rather than printing the results cached for files unchanged since")
+	watchFlag          = flag.Bool("watch", false, "after searching, search files again as they change or are added, below # changed comments or -json watch records")
+	sortFlag           = flag.String("sort", "", "search files in order: path (natural order), or mtime (newest first)")
 )
 
+var (
+	// patternFlags are the patterns given with -e, which may look like anything
+	patternFlags stringList
+	// fileFlags name files of patterns, which may be rules with metadata
+	fileFlags   stringList
+	expandFlags stringList
+)
+
+// stringList is a flag which may be repeated
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, " ") }
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// commands are run by name instead of searching, like gred verify
+var commands map[string]func(args []string)
+
 func init() {
 	flag.Usage = usage
+	flag.Var(&patternFlags, "e", "search for `PATTERN`, even when it begins with @ or -; may be repeated")
+	flag.Var(&fileFlags, "f", "search for the patterns in `FILE`, one per line; may be repeated")
+	flag.BoolVar(nulFlag, "0", false, "the same as -z")
+	flag.Var(&expandFlags, "expand", "with -collapse, show all matches under `DIR`; may be repeated")
+	commands = map[string]func(args []string){
+		"verify":      verifyMode,
+		"clean":       cleanMode,
+		"schema":      schemaMode,
+		"run":         runMode,
+		"preset":      presetMode,
+		"history":     historyMode,
+		"again":       againMode,
+		"save":        saveMode,
+		"load":        loadMode,
+		"index":       indexMode,
+		"mcp":         mcpMode,
+		"help":        helpMode,
+		"format-spec": formatSpecMode,
+	}
 }
 
 // lineidx is zero-indexed but LineNo is 1-indexed
@@ -25,72 +145,235 @@ func newPatchingError(path string, dstno, srcno int, err error) error {
 	return fmt.Errorf("%s:%d %v (patch line %d)", path, dstno, err, srcno)
 }
 
-func usage() {
-	fmt.Fprintln(os.Stderr, `Usage:
-
-Search:
-	(must set GRED or GREDX env var to specify files to search)
-	gred '@*.glob' '<[^>]+>'
-	gred -- -p (-- flag let you search for "-p", yay!)
-	GREDX=.foo.bar gred foo (search *.foo and *.bar files)
-	GREDX=. gred [regexp1] (GREDX=. matches all files)
-
-Patch:
-	GRED=. gred foobar > gred.out
-	vim gred.out
-	cat gred.out | gred -p
-`)
-	os.Exit(2)
+// isFlagSet reports whether the named flag was given on the command line,
+// or in the request being served.
+func isFlagSet(name string) bool {
+	if servedFlags != nil {
+		return servedFlags[name]
+	}
+	var set bool
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+func oneOf(s string, choices []string) bool {
+	for _, c := range choices {
+		if s == c {
+			return true
+		}
+	}
+	return false
 }
 
 func warn(format string, args ...interface{}) {
 	fmt.Fprintf(os.Stderr, "warning: "+format+"\n", args...)
 }
 
+// die exits 2 on errors, as grep does, since 1 means nothing matched.
 func die(format string, args ...interface{}) {
+	flushOutput()
 	fmt.Fprintf(os.Stderr, "error: "+format+"\n", args...)
-	os.Exit(1)
+	os.Exit(2)
 }
 
-func patchMode(patches []*patch) {
-	for _, p := range patches {
-		if patchErr := p.Apply(); patchErr != nil {
-			warn("%v", patchErr)
+// patchMode patches the files, reporting on each to w, and ending with a
+// tree of the lines patched in each directory on stderr. Returns how many
+// files could not be patched.
+func patchMode(w io.Writer, patches []*patch) int {
+	// patched files are written beside the originals unless -tempdir, where
+	// ./system names a directory system rather than the temporary directory
+	tempDir := *tempDirFlag
+	if tempDir == "system" {
+		tempDir = os.TempDir()
+	}
+	orderPatches(patches, *orderFlag)
+	progress := newPatchProgress(len(patches), *progressFlag)
+	tree := newPatchTree()
+	for i, p := range patches {
+		if i > 0 && *patchDelayFlag > 0 {
+			time.Sleep(*patchDelayFlag)
+		}
+		p.relocate = *relocateFlag
+		p.noFollow = !*followFlag
+		p.forceReadOnly = *forceReadOnlyFlag
+		p.tempDir = tempDir
+		p.strict = *strictFlag
+		p.inPlace = *inPlaceFlag
+		if *simulateFlag != "" {
+			shadow, patchErr := p.Simulate(*simulateFlag)
+			switch {
+			case *jsonFlag:
+				printPatchJSON(w, p, shadow, patchErr)
+			case patchErr != nil:
+				warn("%s: %v", p.path, patchErr)
+			default:
+				fmt.Fprintf(w, "%s %d %s\n", p.path, len(p.lines), shadow)
+			}
+			if patchErr == nil {
+				tree.add(p.path, len(p.lines))
+			}
+			progress.add(patchErr != nil)
 			continue
 		}
-		fmt.Printf("%s %d\n", p.path, len(p.lines))
+		patchErr := p.Apply()
+		switch {
+		case *jsonFlag:
+			printPatchJSON(w, p, "", patchErr)
+		case patchErr != nil:
+			warn("%v", patchErr)
+		default:
+			fmt.Fprintf(w, "%s %d\n", p.path, len(p.lines))
+		}
+		if patchErr == nil {
+			tree.add(p.path, len(p.lines))
+		}
+		progress.add(patchErr != nil)
+	}
+	if !*jsonFlag {
+		tree.report(os.Stderr, seps == asciiSeps)
+	}
+	return progress.failed
+}
+
+// parseFlags parses the flags at the start of args and returns the rest.
+// A -- ending the flags is kept, since it also ends the @args.
+func parseFlags(args []string) []string {
+	flag.CommandLine.Parse(args)
+	rest := flag.Args()
+	if len(args) > len(rest) && args[len(args)-len(rest)-1] == "--" {
+		rest = append([]string{"--"}, rest...)
+	}
+	return rest
+}
+
+// checkPatchFlags checks the flags of patch mode, and sets how patch input
+// is read from them.
+func checkPatchFlags() error {
+	if !oneOf(*relocateFlag, relocateModes) {
+		return fmt.Errorf("-relocate must be one of: %s", strings.Join(relocateModes, ", "))
+	}
+	if !oneOf(*orderFlag, patchOrders) {
+		return fmt.Errorf("-order must be one of: %s", strings.Join(patchOrders, ", "))
 	}
+	nulRecords = *nulFlag
+	skipBadLines = *skipBadLinesFlag
+	return nil
 }
 
+// rootDir is the -root changed to, so that it is only done once.
+var rootDir string
+
 func main() {
-	var args []string
-	if len(os.Args) < 2 || os.Args[1] != "--" {
-		flag.Parse()
-		args = flag.Args()
-	} else {
-		args = os.Args[2:]
+	searchArgs = os.Args[1:]
+	startDir, _ = os.Getwd()
+	dispatch(parseFlags(os.Args[1:]))
+}
+
+// dispatch runs the command named by the first of args, or else searches or
+// patches with them.
+func dispatch(args []string) {
+	if err := setSeparators(); err != nil {
+		die("%v", err)
+	}
+	// commands are only recognised before a -- argument
+	if len(args) > 0 {
+		if cmd, ok := commands[args[0]]; ok {
+			chdirRoot()
+			cmd(args[1:])
+			return
+		}
+	}
+	run(args)
+}
+
+// chdirRoot changes to the -root directory: paths from @args, the output
+// and patches are all relative to it.
+func chdirRoot() {
+	if *rootFlag == "" || *rootFlag == rootDir {
+		return
+	}
+	if err := os.Chdir(*rootFlag); err != nil {
+		die("%v", err)
 	}
+	rootDir = *rootFlag
+}
 
+// run patches or searches with the flags parsed already and the other args.
+func run(args []string) {
+	chdirRoot()
+	if maxPatchLine = *maxLineFlag; maxPatchLine < 1 {
+		die("-max-line must be at least 1")
+	}
+	if *serveFlag != "" {
+		serve(*serveFlag)
+		return
+	}
 	if *patchFlag {
+		if err := checkPatchFlags(); err != nil {
+			die("%v", err)
+		}
 		patches, err := patchInput(args)
+		if err == nil && patches != nil && *selectFlag {
+			if patches, err = selectPatches(patches); err == nil && patches == nil {
+				return
+			}
+		}
 		switch {
 		case err != nil:
 			die("%v", err)
 		case patches == nil:
 			warn("stdin patches included no changes and were ignored")
 		default:
-			patchMode(patches)
+			// refused and failed patches exit 2, as files which could not
+			// be searched do
+			if failed := patchMode(os.Stdout, patches); failed > 0 {
+				die("%d of %d files were not patched", failed, len(patches))
+			}
 		}
 		return
 	}
 
+	var reviewed bytes.Buffer
+	if *tuiFlag {
+		searchOutput = &reviewed
+	}
 	s, err := loadSearchConfig(args)
 	switch {
-	case s == nil:
-		usage()
 	case err != nil:
 		die("%v", err)
+	case s == nil:
+		warn("give patterns to search for, and the files to search as @args or in GREDX")
+		usage()
 	default:
-		search(s)
+		if err := recordSearch(); err != nil {
+			warn("history: %v", err)
+		}
+		if err := search(s); err != nil {
+			die("%v", err)
+		}
+		if *tuiFlag {
+			if err := reviewMode(reviewed.Bytes()); err != nil {
+				die("%v", err)
+			}
+			return
+		}
+		if *watchFlag {
+			if err := watch(s); err != nil {
+				die("%v", err)
+			}
+		}
+		// like grep, gred exits 0 with matches and 1 without, unless files
+		// could not be searched, which exits 2 except when -q found one
+		switch {
+		case s.summary.matched > 0 && (s.quiet || s.summary.failed == 0):
+		case s.summary.failed > 0:
+			os.Exit(2)
+		default:
+			os.Exit(1)
+		}
 	}
 }
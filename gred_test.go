@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMain runs gred itself when GRED_TEST_MAIN is set, so that tests can
+// run the test binary as the gred command, exit status and all.
+func TestMain(m *testing.M) {
+	if os.Getenv("GRED_TEST_MAIN") != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// gredResult is what a run of gred printed, and its exit status.
+type gredResult struct {
+	stdout, stderr string
+	code           int
+}
+
+// runGred runs gred with args in dir, with stdin as its input and env set
+// over an environment without history, index, cache or config.
+func runGred(t *testing.T, dir, stdin string, env []string, args ...string) gredResult {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Env = append(os.Environ(), "GRED_TEST_MAIN=1", "GRED_HISTORY=-", "GRED_INDEX=-", "GRED_CACHE=-",
+		"GRED_CONFIG="+filepath.Join(dir, "no-config"), "GREDX=", "GRED_SEP=")
+	cmd.Env = append(cmd.Env, env...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	var exit *exec.ExitError
+	code := 0
+	switch {
+	case errors.As(err, &exit):
+		code = exit.ExitCode()
+	case err != nil:
+		t.Fatalf("running gred %s: %v", strings.Join(args, " "), err)
+	}
+	return gredResult{stdout.String(), stderr.String(), code}
+}
+
+// writeFiles writes the files by path under a new temporary directory, and
+// returns the directory.
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for path, data := range files {
+		path = filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// readTestFile returns the content of the file at path under dir.
+func readTestFile(t *testing.T, dir, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(path)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// dirGroups gathers the output of each file searched by its directory, so
+// that directories with more than a threshold of matches can be collapsed.
+type dirGroups struct {
+	// collapse is the most matches of a directory printed in full
+	collapse int
+	// expand are directories never collapsed, with those below them
+	expand []string
+	order  []*dirGroup
+	byDir  map[string]*dirGroup
+	// counts are the matched lines printed for each path, which the workers
+	// searching write under the lock of the searchConfig
+	counts map[string]int
+}
+
+type dirGroup struct {
+	dir            string
+	files, matches int
+	out            bytes.Buffer
+}
+
+func newDirGroups(collapse int, expand []string) *dirGroups {
+	for i, dir := range expand {
+		expand[i] = filepath.Clean(dir)
+	}
+	return &dirGroups{
+		collapse: collapse,
+		expand:   expand,
+		byDir:    make(map[string]*dirGroup),
+		counts:   make(map[string]int),
+	}
+}
+
+// add keeps the output of searching the file at path, with the matches it
+// counted. Groups are printed in the order their first file is added.
+func (g *dirGroups) add(path string, out []byte, matches int) {
+	if len(out) == 0 {
+		return
+	}
+	dir := filepath.Dir(path)
+	grp := g.byDir[dir]
+	if grp == nil {
+		grp = &dirGroup{dir: dir}
+		g.byDir[dir] = grp
+		g.order = append(g.order, grp)
+	}
+	grp.files++
+	grp.matches += matches
+	grp.out.Write(out)
+}
+
+func (g *dirGroups) expanded(dir string) bool {
+	for _, e := range g.expand {
+		if dir == e || e == "." || strings.HasPrefix(dir, e+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// print writes each group, or a comment line standing in for it when it is
+// collapsed. Patch mode ignores the comments.
+func (g *dirGroups) print(w io.Writer) {
+	for _, grp := range g.order {
+		if grp.matches <= g.collapse || g.expanded(grp.dir) {
+			w.Write(grp.out.Bytes())
+			continue
+		}
+		fmt.Fprintf(w, "# %s: %d matches in %d files collapsed, -expand %s to show them\n",
+			grp.dir, grp.matches, grp.files, grp.dir)
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// TestCollapseParallel counts the matches of each directory while four
+// workers search its files, which go test -race checks are not raced.
+func TestCollapseParallel(t *testing.T) {
+	files := make(map[string]string)
+	for i := 0; i < 40; i++ {
+		files[fmt.Sprintf("big/f%02d.txt", i)] = strings.Repeat("foo\n", 20)
+		files[fmt.Sprintf("small/f%02d.txt", i)] = "foo\n"
+	}
+	dir := writeFiles(t, files)
+	r := runGred(t, dir, "", []string{"GREDX=.txt"}, "-j", "4", "-collapse", "100", "foo")
+	if r.code != 0 || strings.Contains(r.stderr, "DATA RACE") {
+		t.Fatalf("exit %d\n%s", r.code, r.stderr)
+	}
+	want := "# big: 800 matches in 40 files collapsed, -expand big to show them\n"
+	if !strings.HasPrefix(r.stdout, want) {
+		t.Errorf("printed\n%.200s\nwant it to begin\n%s", r.stdout, want)
+	}
+	if n := strings.Count(r.stdout, "\tsmall/"); n != 40 {
+		t.Errorf("printed %d records of small, want 40", n)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package main
+
+import "os"
+
+// linkCount returns 1, the hard links of files not being known here.
+func linkCount(finfo os.FileInfo) int {
+	return 1
+}
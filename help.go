@@ -0,0 +1,339 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// A helpTopic is a part of the usage, which gred help NAME prints alone,
+// followed by the flags it picks.
+type helpTopic struct {
+	name, summary string
+	text          func() string
+	flags         func(f *flag.Flag) bool
+}
+
+// commandSummaries describe the commands for gred help.
+var commandSummaries = map[string]string{
+	"again":       "run the last, or nth last, search again where it ran",
+	"clean":       "remove temporary files left by interrupted patching",
+	"format-spec": "print the text format of search output and patch input",
+	"help":        "print the usage, or one topic of it",
+	"history":     "list the recent searches",
+	"index":       "index the files GREDX selects for faster searches",
+	"load":        "print a saved session, or list them",
+	"mcp":         "serve search and patch as Model Context Protocol tools",
+	"preset":      "list the built-in rule packs, or print the rules of one",
+	"run":         "run a profile of the config file, or list them",
+	"save":        "save search output as a session",
+	"schema":      "print the JSON Schema of -json output",
+	"verify":      "check that search output of files patches back byte for byte",
+}
+
+// isPatchFlag reports whether f is a flag of patch mode: -p, those described
+// as "with -p", and those which both search and patch mode read.
+func isPatchFlag(f *flag.Flag) bool {
+	return f.Name == "p" || strings.HasPrefix(f.Usage, "with -p") ||
+		oneOf(f.Name, []string{"root", "json", "z", "0", "max-line"})
+}
+
+func isSearchFlag(f *flag.Flag) bool {
+	return f.Name != "p" && !strings.HasPrefix(f.Usage, "with -p")
+}
+
+func helpTopics() []helpTopic {
+	return []helpTopic{
+		{"search", "searching files, and replacing matches", searchHelp, isSearchFlag},
+		{"globs", "choosing the files searched, with @args and GREDX", globsHelp, nil},
+		{"patch", "patching files with edited search output", patchHelp, isPatchFlag},
+		{"format", "the records of search output, which patch mode reads", formatHelp, nil},
+		{"more", "commands, git, caches, and serving searches", moreHelp, nil},
+	}
+}
+
+func searchHelp() string {
+	return `Search:
+	gred '@*.glob' '<[^>]+>' (files are given by @args, or else by GREDX, see gred help globs)
+	gred -- -p (-- flag let you search for "-p", yay!)
+	GREDX=./src gred -- @Override (patterns after -- are never globs)
+	GREDX=./src gred -F 'a.b[0]' (no need to escape code snippets)
+	GREDX=.go gred -o 'v[0-9]+' (print matches alone as path:line:start-end)
+	GREDX=.go gred -blame -json TODO (who wrote each TODO, to route them)
+	GREDX=.go gred -m 1 -max-total 20 TODO (the first TODO of at most 20 files)
+	GREDX=.go gred -dedup-content foo (skip copies of vendored files)
+	GREDX=.log gred -last 5 ERROR (the latest errors of each log)
+	GREDX=.go gred -rank -i 'retry|backoff' (where the concept lives, best first)
+	GREDX=.go gred -owners -group-by owner TODO (route TODOs by CODEOWNERS)
+	GREDX=.go gred -multiline 'if err != nil \{\n' (edit matches across lines as one record)
+	GREDX=.go gred -go-ast 'errors.New(fmt.Sprintf(f, a))' -replace 'fmt.Errorf(f, a)' (match Go syntax)
+	GREDX=.go gred -sample 20 -e Foo -e Bar (a taste of the matches of each)
+	GREDX=. gred -z foo | xargs -0 ... (records survive odd paths and lines)
+	GREDX=.go gred -column foo (path:line:column for editors to jump to)
+	GREDX=.go gred -q foo && echo found (exits 0 on a match, 1 without, 2 on errors)
+	GREDX=.go gred -ascii foo (for terminals and tools which only take ASCII)
+	GREDX=.go gred -heading foo (each path once above its lines, which still patch)
+	GREDX=.go gred -color always foo | less -R (keep highlighting through a pager)
+	GRED_HYPERLINK='vscode://file{path}:{line}:{column}' GREDX=.go gred -hyperlink foo (click to edit)
+	GREDX=.go gred -w -replace ident id (rename id but not ids or valid)
+	GREDX=./src gred -e -p -e @home (-e gives patterns which look like anything)
+	GREDX=.go gred -collapse 50 -expand vendor/x foo (hide noisy directories)
+	GREDX=. gred -root /mnt/nfs -io-limit 5M -j 2 foo (go easy on shared storage)
+	GREDX=. gred -j 8 -unordered foo (faster, but in no set order)
+	GREDX=.log gred -mmap -j 4 ERROR (map large logs rather than copying them in)
+	GREDX=.go gred -watch TODO (then the TODOs of each file saved, as it is)
+
+Files are searched and printed in a set order, so the output of two runs can
+be diffed: @FILE arguments as given, and the files under each directory walked
+in the byte order of their names, with or without -j. -sort, -rank and
+-collapse order them otherwise.
+
+Large files, pipes, and files read with -io-limit are searched a window at a
+time, so memory use is bounded by the length of their lines, which may be at
+most -max-line bytes. Only -go-ast, -dedup-content, -show-function, -multiline
+and -passthru read them whole. Files from 64MB, or from 64KB with -mmap, are
+mapped into memory instead where the platform allows.
+
+Replace:
+	GREDX=.go gred -replace 'newName' -preview 'oldName'
+	GREDX=.go gred -replace 'newName' 'oldName' | gred -p
+`
+}
+
+func globsHelp() string {
+	return `Files are given by @args: @FILE searches FILE, and any other @arg is a
+glob of the names of files to search under the current directory, such as
+'@*.go'. Without them, GREDX gives the files as dotted parts: .go for *.go
+files, . for every file, .!_test.go to leave out *_test.go files, ./dir to only
+walk dir, and .!/dir never to walk it. Hidden directories are not walked, nor
+what .gitignore and .gredignore files ignore unless -no-ignore. Both have the
+syntax of .gitignore, and .gredignore overrides in each directory:
+	GREDX=.foo.bar gred foo (search *.foo and *.bar files)
+	GREDX=. gred [regexp1] (GREDX=. matches all files)
+	GREDX=.go.!_test.go gred foo (search *.go but not *_test.go files)
+	GREDX=.yaml./configs.!/configs/old gred foo (search *.yaml under configs/)
+	GREDX=.js gred -no-ignore foo (search files .gitignore ignores, like node_modules, too)
+	echo testdata/ >> .gredignore (skip files in searches alone, as .gitignore does)
+`
+}
+
+func patchHelp() string {
+	return `Patch:
+	GREDX=. gred foobar > gred.out
+	vim gred.out (blank lines and lines starting with # are ignored)
+	cat gred.out | gred -p (exits 2 if any file could not be patched)
+	GREDX=. gred -C 2 foobar > gred.out (context lines may be edited as well)
+	gred -p gred.out more.out (merges edits, failing on conflicting ones)
+	gred -p -simulate /tmp/shadow < gred.out (diff -r . /tmp/shadow to review)
+	gred -p -skip-bad-lines < gred.out (patch the rest when some lines were mangled)
+	GREDX=.go gred -tui -replace Bar Foo (edit or turn off replaced lines, then patch)
+	gred -p -select < gred.out (pick the files to patch from a list)
+	gred -p -relocate global < gred.out (find moved lines anywhere they are unique)
+	gred -p -force-readonly < gred.out (patch read-only files, which are refused otherwise)
+	gred -p -tempdir system < gred.out (keep temporary files out of watched directories)
+	gred -p -in-place < gred.out (keep hard links and the inodes of files held open)
+	gred -p -order path -patch-delay 1s < gred.out (one file a second, e.g. for a file watcher)
+	gred -root ~/src/proj -p < gred.out (patch paths relative to -root)
+	gred -abs-paths foo @a.go @b/c.go > gred.out (patch from any directory)
+
+Verify that search output patches back byte for byte:
+	gred verify main.go README.md
+
+`
+}
+
+// formatHelp describes the records of search output, as patchPrefixRe reads
+// them, with the separators of each kind of line.
+func formatHelp() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `Search output records, which patch mode reads back, are lines of three tab
+separated fields, with the parts in brackets added by some flags:
+	%s
+
+SEP gives the kind of line, in box drawing or, with -ascii, ASCII:
+`, recordLayout)
+	for _, k := range lineKinds {
+		fmt.Fprintf(&b, "\t%c %c  %s\n", boxSeps.of(k.sep), asciiSeps.of(k.sep), k.desc)
+	}
+	b.WriteString(`
+CRC is the CRC32 of the line as searched, as five ASCII85 characters, which
+patch mode checks before replacing it, and ABOVE and BELOW those of the lines
+around it, with -anchor or -hunk, or five spaces where there are none. LINE
+counts from 1, and END is the last line of a -multiline match. COL-COLEND are
+the byte columns of the text printed by -o, from 1 and just past it, and COLUMN
+and OFFSET those of -column and -byte-offset, which patch mode ignores. With
+-heading, PATH: is left out, being on the heading line above. Blank lines and
+lines beginning with # are ignored. With -z, records end with NUL rather than
+a newline, and backslashes and newlines in paths and text are escaped as \\
+and \n.
+
+GRED_SEP=ascii prints the ASCII separators too, or GRED_SEP may give eight of
+its own, in the order above. Patch mode reads any of them.
+`)
+	return b.String()
+}
+
+func moreHelp() string {
+	var b strings.Builder
+	b.WriteString(`Run a named profile of flags, patterns and GREDX from the config file
+($GRED_CONFIG, or gred/config in the user config directory):
+	gred run (list the profiles)
+	gred run todos [more flags and patterns]
+
+Rerun recent searches, kept in $GRED_HISTORY or gred/history in the user
+config directory (GRED_HISTORY=- keeps none):
+	gred history (list them, numbered back from the last)
+	gred again [n] (run the last, or nth last, search again where it ran)
+
+Save search output to resume it later, in $GRED_SESSIONS or gred/sessions
+in the user config directory. Loading comments out records whose lines
+changed since, as # stale:
+	GREDX=.go gred TODO | gred save todos (or gred save todos gred.out)
+	gred load todos > gred.out (and edit and patch it as usual)
+	gred load (list the sessions)
+
+Search with a built-in rule pack, here for credentials, naming rules in -json:
+	GREDX=. gred -preset secrets -json
+	GREDX=.go gred -f rules.txt -json (pattern<TAB>id<TAB>severity<TAB>message lines)
+	gred preset (list the packs) or gred preset secrets (print their rules)
+
+Report matches on lines changed since a git ref, such as in a pull request:
+	GREDX=.go gred -diff-only origin/main 'fmt\.Print'
+	GREDX=.go gred -tracked 'fmt\.Print' (only in the files git tracks, as git ls-files lists)
+
+Search the files as they were at a git revision, printed as REV:path, or
+find the commits of a range which changed how many matches each file has,
+as git log -S does, with their files as they were after each below # commit
+comments. Neither output patches, the files not being those on disk:
+	GREDX=.go gred -rev v1.0 'secretKey'
+	GREDX=.go gred -rev v1.0..v2.0 'secretKey'
+
+Report only new matches, after recording those there are now:
+	GREDX=.go gred -baseline known.json -update-baseline 'panic\('
+	GREDX=.go gred -baseline known.json 'panic\('
+
+Index the files GREDX selects, so that later searches from the same directory
+only read those with the trigrams their patterns need, in $GRED_INDEX or
+gred/index in the user cache directory (GRED_INDEX=- uses none). Files added
+or changed since are searched as usual; run it again to take them in:
+	GREDX=.go gred index (or gred index '@*.go' '@*.md')
+	GREDX=.go gred -no-index foo (read every file anyway)
+
+The output of each search is cached for every file, readable by the user
+alone, in $GRED_CACHE or gred/results in the user cache directory
+(GRED_CACHE=- caches nothing), so that running it again only searches the files
+changed since. Searches whose output depends on more than each file, such as
+-unique, -max-total or -diff-only, are not cached, nor those for the patterns
+of -preset and -f, which may find secrets. -no-cache searches every file anyway.
+
+Serve searches and patches over HTTP, one at a time, with the flags given as
+the defaults of each request. POST /search takes a JSON object of patterns,
+globs (the @args), gredx and flags, and answers with the -json records, or
+the text output with "text": true. POST /patch takes patch input, with flags
+in the query, and answers with the -json patch reports. Only files below the
+directory served may be searched and patched, and flags which write elsewhere,
+like -simulate and -baseline, are refused. The server listens on localhost
+unless the address names a host, and requests must give $GRED_SERVE_TOKEN, or
+else the token it prints, as Authorization: Bearer TOKEN:
+	GRED_SERVE_TOKEN=$(openssl rand -hex 16) gred -serve :8080
+	curl -H "Authorization: Bearer $GRED_SERVE_TOKEN" \
+		-d '{"patterns": ["TODO"], "gredx": ".go", "flags": {"i": true}}' localhost:8080/search
+	curl -H "Authorization: Bearer $GRED_SERVE_TOKEN" \
+		--data-binary @gred.out 'localhost:8080/patch?relocate=global'
+
+Serve the same search and patch as Model Context Protocol tools on stdin and
+stdout, for coding agents and other automation:
+	GREDX=.go gred mcp
+
+Print the JSON Schema of -json search output and patch reports, or the text
+format of search output and patch input, as JSON with -json, for tools which
+read or write it:
+	gred schema
+	gred format-spec (or gred -json format-spec)
+
+Remove temporary files left next to sources when patching was interrupted:
+	gred clean -n (list them) or gred clean [dir ...] (the -tempdir too)
+
+`)
+	b.WriteString("Commands, run as gred COMMAND [args]:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, "\t%-11s %s\n", name, commandSummaries[name])
+	}
+	return b.String()
+}
+
+// usage points to gred help on bad flags and arguments, and prints every
+// topic and then every flag with -h.
+func usage() {
+	if !helpAsked() {
+		fmt.Fprintln(os.Stderr, "see gred help for the usage, or gred -h for all of it")
+		os.Exit(2)
+	}
+	fmt.Fprint(os.Stderr, "Usage:\n\n")
+	for _, t := range helpTopics() {
+		fmt.Fprintln(os.Stderr, t.text())
+	}
+	fmt.Fprint(os.Stderr, "gred help TOPIC prints one of these; see gred help.\n\nOptions:\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+// helpAsked reports whether -h or -help is among the flags.
+func helpAsked() bool {
+	for _, arg := range os.Args[1:] {
+		switch arg {
+		case "--":
+			return false
+		case "-h", "-help", "--h", "--help":
+			return true
+		}
+	}
+	return false
+}
+
+// helpMode lists the topics, or prints the one named with its flags.
+func helpMode(args []string) {
+	topics := helpTopics()
+	if len(args) == 0 {
+		fmt.Println("gred help TOPIC prints one part of the usage, where TOPIC is one of:")
+		for _, t := range topics {
+			fmt.Printf("\t%-8s %s\n", t.name, t.summary)
+		}
+		fmt.Println("\ngred -h prints them all, with every flag.")
+		return
+	}
+	var names []string
+	for _, t := range topics {
+		if t.name == args[0] {
+			fmt.Print(t.text())
+			if t.flags != nil {
+				fmt.Print("\nOptions:\n")
+				printFlags(os.Stdout, t.flags)
+			}
+			return
+		}
+		names = append(names, t.name)
+	}
+	die("help: no topic %s, give one of: %s", args[0], strings.Join(names, ", "))
+}
+
+// printFlags prints the defaults of the flags picked, as flag.PrintDefaults
+// prints them all.
+func printFlags(w io.Writer, pick func(f *flag.Flag) bool) {
+	fs := flag.NewFlagSet("gred", flag.ContinueOnError)
+	fs.SetOutput(w)
+	flag.VisitAll(func(f *flag.Flag) {
+		if pick(f) {
+			fs.Var(f.Value, f.Name, f.Usage)
+		}
+	})
+	fs.PrintDefaults()
+}
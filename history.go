@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// historySize is how many searches the history file keeps.
+const historySize = 100
+
+// A history entry is one line of words, split as config args are: the time
+// of the search, the directory it ran in, its GREDX and then its command
+// line arguments.
+type historyEntry struct {
+	time  time.Time
+	root  string
+	gredx string
+	args  []string
+}
+
+// searchArgs are the command line arguments of the search being run, and
+// startDir where it was run from, before any -root, which are recorded in
+// the history
+var (
+	searchArgs []string
+	startDir   string
+)
+
+// historyPath is $GRED_HISTORY, or else gred/history in the user's config
+// directory. It is empty when GRED_HISTORY is -, which turns the history
+// off.
+func historyPath() (string, error) {
+	if path := os.Getenv("GRED_HISTORY"); path == "-" {
+		return "", nil
+	} else if path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gred", "history"), nil
+}
+
+func readHistory(path string) ([]*historyEntry, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var hist []*historyEntry
+	scan := bufio.NewScanner(f)
+	scan.Buffer(nil, maxPatchLine)
+	for lineno := 1; scan.Scan(); lineno++ {
+		words, err := splitWords(scan.Text())
+		if err == nil && len(words) < 3 {
+			err = errors.New("expected time, root and GREDX")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, lineno, err)
+		}
+		t, err := time.Parse(time.RFC3339, words[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, lineno, err)
+		}
+		hist = append(hist, &historyEntry{t, words[1], words[2], words[3:]})
+	}
+	return hist, scan.Err()
+}
+
+// recordSearch adds the search being run to the end of the history, unless
+// it is the same as the last one there.
+func recordSearch() error {
+	path, err := historyPath()
+	if path == "" || err != nil {
+		return err
+	}
+	hist, err := readHistory(path)
+	if err != nil {
+		return err
+	}
+	e := &historyEntry{time.Now().UTC(), startDir, os.Getenv("GREDX"), searchArgs}
+	if n := len(hist); n > 0 && hist[n-1].same(e) {
+		hist[n-1].time = e.time
+	} else {
+		hist = append(hist, e)
+	}
+	if len(hist) > historySize {
+		hist = hist[len(hist)-historySize:]
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	var b strings.Builder
+	for _, e := range hist {
+		words := append([]string{e.time.Format(time.RFC3339), e.root, e.gredx}, e.args...)
+		for i, w := range words {
+			words[i] = quoteWord(w)
+		}
+		b.WriteString(strings.Join(words, " "))
+		b.WriteByte('\n')
+	}
+	// replaced whole, so that a search interrupted while writing it cannot
+	// leave half a history
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(b.String()), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (e *historyEntry) same(o *historyEntry) bool {
+	if e.root != o.root || e.gredx != o.gredx || len(e.args) != len(o.args) {
+		return false
+	}
+	for i := range e.args {
+		if e.args[i] != o.args[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// quoteWord quotes w so that splitWords gives it back, leaving plain
+// words as they are.
+func quoteWord(w string) string {
+	if w != "" && !strings.ContainsAny(w, " \t'\"\\") {
+		return w
+	}
+	return "'" + strings.ReplaceAll(w, "'", `'\''`) + "'"
+}
+
+// String is the entry as a command line to run it from its root.
+func (e *historyEntry) String() string {
+	words := make([]string, len(e.args))
+	for i, w := range e.args {
+		words[i] = quoteWord(w)
+	}
+	cmd := "gred " + strings.Join(words, " ")
+	if e.gredx != "" {
+		cmd = "GREDX=" + quoteWord(e.gredx) + " " + cmd
+	}
+	return cmd
+}
+
+// historyMode lists the searches in the history, oldest first, numbered
+// back from the last as gred again takes them.
+func historyMode(args []string) {
+	if len(args) != 0 {
+		warn("history does not accept arguments")
+		usage()
+	}
+	hist := loadHistory()
+	for i, e := range hist {
+		fmt.Printf("%4d  %s  %s  %s\n", len(hist)-i, e.time.Local().Format("2006-01-02 15:04"), e.root, e)
+	}
+}
+
+// againMode runs the search n back in the history again, in the directory
+// and with the GREDX it ran with. n is 1, the last search, by default.
+func againMode(args []string) {
+	n := 1
+	switch {
+	case len(args) > 1:
+		warn("again accepts only the number of the search")
+		usage()
+	case len(args) == 1:
+		var err error
+		if n, err = strconv.Atoi(args[0]); err != nil || n < 1 {
+			die("again: %q is not a search number, see gred history", args[0])
+		}
+	}
+	hist := loadHistory()
+	if n > len(hist) {
+		die("again: there are only %d searches in the history", len(hist))
+	}
+	e := hist[len(hist)-n]
+	if err := os.Chdir(e.root); err != nil {
+		die("%v", err)
+	}
+	os.Setenv("GREDX", e.gredx)
+	fmt.Fprintf(os.Stderr, "%s\n", e)
+	// flags given before again still apply, the search's own are added
+	searchArgs, startDir = e.args, e.root
+	dispatch(parseFlags(e.args))
+}
+
+func loadHistory() []*historyEntry {
+	path, err := historyPath()
+	if err != nil {
+		die("%v", err)
+	}
+	if path == "" {
+		die("the history is turned off by GRED_HISTORY=-")
+	}
+	hist, err := readHistory(path)
+	if err != nil {
+		die("%v", err)
+	}
+	return hist
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// A trigramIndex lists, for each trigram of the files under a directory,
+// the files it is found in, so that searches only need to read those which
+// have every trigram a pattern must match. Trigrams are three bytes, with
+// ASCII letters lowercased so that -i patterns may use the index too, kept
+// in the low bits of a uint32. The index is written by gred index with gob
+// to $GRED_INDEX, or else a file in gred/index in the user's cache
+// directory named for the directory indexed.
+type trigramIndex struct {
+	Root  string
+	Files []indexedFile
+	// Postings holds the ids of the files with each trigram in order, as
+	// varints of the differences between them
+	Postings map[uint32][]byte
+	// ids and candidates are filled in for a search by prepare
+	ids        map[string]int
+	candidates []bool
+}
+
+// indexedFile is a file of the index, with its freshness when indexed:
+// files which changed since are searched whatever the index says.
+type indexedFile struct {
+	Path  string
+	Size  int64
+	Mtime time.Time
+}
+
+// indexPath is $GRED_INDEX, or else gred/index/HASH in the user's cache
+// directory, for the absolute path of root. It is empty when GRED_INDEX is
+// -, which turns the index off.
+func indexPath(root string) (string, error) {
+	if path := os.Getenv("GRED_INDEX"); path == "-" {
+		return "", nil
+	} else if path != "" {
+		return path, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(root))
+	return filepath.Join(dir, "gred", "index", hex.EncodeToString(sum[:8])), nil
+}
+
+// indexMode writes the index of the files a search with args and GREDX
+// would read. The args may only be @paths, since it is the files which are
+// indexed, whatever patterns are searched for later.
+func indexMode(args []string) {
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "@") {
+			die("index: %s is not an @path, only files are indexed", arg)
+		}
+	}
+	root, err := os.Getwd()
+	if err != nil {
+		die("%v", err)
+	}
+	path, err := indexPath(root)
+	switch {
+	case err != nil:
+		die("%v", err)
+	case path == "":
+		die("index: GRED_INDEX is -, which turns the index off")
+	}
+	// -- ends the @paths with no patterns, for the config to be loaded
+	// with only GREDX
+	s, err := loadSearchConfig(append(args, "--"))
+	switch {
+	case err != nil:
+		die("%v", err)
+	case s == nil:
+		usage()
+	}
+	start := time.Now()
+	b := newIndexBuilder(root)
+	s.indexer = b
+	// the files are read one at a time, in the order they are walked
+	s.jobs, s.sortBy, s.rank, s.groups = 1, "", nil, nil
+	if err := searchFiles(s); err != nil {
+		die("%v", err)
+	}
+	s.summary.report()
+	if err := b.idx.write(path); err != nil {
+		die("index: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "indexed %d files, %d trigrams, in %v: %s\n",
+		len(b.idx.Files), len(b.idx.Postings), time.Since(start).Round(time.Millisecond), path)
+}
+
+// indexBuilder adds the files searched to an index.
+type indexBuilder struct {
+	idx *trigramIndex
+	// seen marks the trigrams of the file being added, which are also
+	// listed in found, and last holds the id of the last file with each
+	seen  []uint64
+	found []uint32
+	last  map[uint32]int
+	buf   []byte
+}
+
+func newIndexBuilder(root string) *indexBuilder {
+	return &indexBuilder{
+		idx:  &trigramIndex{Root: root, Postings: make(map[uint32][]byte)},
+		seen: make([]uint64, 1<<24/64),
+		last: make(map[uint32]int),
+		buf:  make([]byte, streamBlock),
+	}
+}
+
+// lowerASCII lowercases the ASCII letters of the bytes indexed, and of the
+// trigrams looked up.
+func lowerASCII(b byte) byte {
+	if 'A' <= b && b <= 'Z' {
+		return b + 'a' - 'A'
+	}
+	return b
+}
+
+// add reads the file f opened from path, adding its trigrams to the index.
+func (b *indexBuilder) add(path string, f *os.File) error {
+	finfo, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if !finfo.Mode().IsRegular() {
+		return nil
+	}
+	var t uint32
+	n := 0
+	b.found = b.found[:0]
+	for {
+		m, err := f.Read(b.buf)
+		for _, c := range b.buf[:m] {
+			t = (t<<8 | uint32(lowerASCII(c))) & 0xffffff
+			if n++; n >= 3 && b.seen[t/64]&(1<<(t%64)) == 0 {
+				b.seen[t/64] |= 1 << (t % 64)
+				b.found = append(b.found, t)
+			}
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			for _, t := range b.found {
+				b.seen[t/64] = 0
+			}
+			return err
+		}
+	}
+	id := len(b.idx.Files)
+	b.idx.Files = append(b.idx.Files, indexedFile{filepath.Clean(path), finfo.Size(), finfo.ModTime()})
+	var delta [binary.MaxVarintLen64]byte
+	for _, t := range b.found {
+		b.seen[t/64] = 0
+		n := binary.PutUvarint(delta[:], uint64(id-b.last[t]))
+		b.idx.Postings[t] = append(b.idx.Postings[t], delta[:n]...)
+		b.last[t] = id
+	}
+	return nil
+}
+
+// write replaces the index at path, through a temporary file so that
+// searches never read half of one.
+func (idx *trigramIndex) write(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), tempPrefix)
+	if err != nil {
+		return err
+	}
+	err = gob.NewEncoder(f).Encode(idx)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// readIndex reads the index of root, which is nil when there is none.
+func readIndex(root string) (*trigramIndex, error) {
+	path, err := indexPath(root)
+	if path == "" || err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var idx trigramIndex
+	if err := gob.NewDecoder(f).Decode(&idx); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if idx.Root != root {
+		// GRED_INDEX names the index of another directory
+		return nil, nil
+	}
+	return &idx, nil
+}
+
+// prepare works out which files of the index may match pats. It reports
+// false when some pattern needs no trigram, so that the index rules no file
+// out.
+func (idx *trigramIndex) prepare(pats []*regexp.Regexp) bool {
+	idx.candidates = make([]bool, len(idx.Files))
+	for _, re := range pats {
+		q, ok := patternQuery(re)
+		if !ok || q == nil {
+			return false
+		}
+		for _, all := range q {
+			for _, id := range idx.lookup(all) {
+				idx.candidates[id] = true
+			}
+		}
+	}
+	idx.ids = make(map[string]int, len(idx.Files))
+	for id, f := range idx.Files {
+		idx.ids[f.Path] = id
+	}
+	return true
+}
+
+// lookup returns the ids of the files with all of the trigrams.
+func (idx *trigramIndex) lookup(all []uint32) []int {
+	lists := make([][]int, len(all))
+	for i, t := range all {
+		lists[i] = idx.postings(t)
+	}
+	// intersect from the shortest list
+	sort.Slice(lists, func(i, j int) bool { return len(lists[i]) < len(lists[j]) })
+	ids := lists[0]
+	for _, list := range lists[1:] {
+		kept, j := ids[:0], 0
+		for _, id := range ids {
+			for j < len(list) && list[j] < id {
+				j++
+			}
+			if j < len(list) && list[j] == id {
+				kept = append(kept, id)
+			}
+		}
+		ids = kept
+	}
+	return ids
+}
+
+func (idx *trigramIndex) postings(t uint32) []int {
+	var ids []int
+	id := 0
+	for data := idx.Postings[t]; len(data) > 0; {
+		delta, n := binary.Uvarint(data)
+		if n <= 0 {
+			break
+		}
+		id += int(delta)
+		ids = append(ids, id)
+		data = data[n:]
+	}
+	return ids
+}
+
+// mayMatch reports whether the file opened by path may match the patterns
+// prepared: files not in the index, or which changed since it was made,
+// are always searched.
+func (idx *trigramIndex) mayMatch(path string) bool {
+	id, ok := idx.ids[filepath.Clean(path)]
+	if !ok || idx.candidates[id] {
+		return true
+	}
+	finfo, err := os.Stat(longPath(path))
+	if err != nil {
+		// the search reports the error
+		return true
+	}
+	f := idx.Files[id]
+	return !freshness{f.Size, f.Mtime}.same(freshness{finfo.Size(), finfo.ModTime()})
+}
+
+// A trigramQuery is the trigrams a file must have to match a pattern, as
+// sets of trigrams which are all needed, any one set of which will do. It
+// is nil when any file may match.
+type trigramQuery [][]uint32
+
+// maxQuerySets is how many sets a query may have before the trigrams of
+// some part of a pattern are given up on, leaving the query looser.
+const maxQuerySets = 64
+
+// patternQuery returns the query of a compiled pattern.
+func patternQuery(re *regexp.Regexp) (trigramQuery, bool) {
+	parsed, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		return nil, false
+	}
+	return regexpQuery(parsed.Simplify()), true
+}
+
+func regexpQuery(re *syntax.Regexp) trigramQuery {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return literalQuery(re.Rune, re.Flags&syntax.FoldCase != 0)
+	case syntax.OpCapture:
+		return regexpQuery(re.Sub[0])
+	case syntax.OpPlus:
+		return regexpQuery(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min >= 1 {
+			return regexpQuery(re.Sub[0])
+		}
+	case syntax.OpAlternate:
+		var q trigramQuery
+		for _, sub := range re.Sub {
+			sq := regexpQuery(sub)
+			if sq == nil || len(q)+len(sq) > maxQuerySets {
+				return nil
+			}
+			q = append(q, sq...)
+		}
+		return q
+	case syntax.OpConcat:
+		return concatQuery(re.Sub)
+	}
+	return nil
+}
+
+// concatQuery joins the literals of subs which follow each other, across
+// anchors and boundaries which match no text, and needs the trigrams of
+// each part.
+func concatQuery(subs []*syntax.Regexp) trigramQuery {
+	var q trigramQuery
+	var run []rune
+	fold := false
+	flush := func() {
+		q = andQuery(q, literalQuery(run, fold))
+		run = nil
+	}
+	for _, sub := range subs {
+		switch sub.Op {
+		case syntax.OpBeginLine, syntax.OpEndLine, syntax.OpBeginText, syntax.OpEndText,
+			syntax.OpWordBoundary, syntax.OpNoWordBoundary, syntax.OpEmptyMatch:
+			continue
+		case syntax.OpLiteral:
+			if f := sub.Flags&syntax.FoldCase != 0; f != fold {
+				flush()
+				fold = f
+			}
+			run = append(run, sub.Rune...)
+			continue
+		}
+		flush()
+		q = andQuery(q, regexpQuery(sub))
+	}
+	flush()
+	return q
+}
+
+// andQuery needs both queries, or gives up the trigrams of b when that
+// would make too many sets.
+func andQuery(a, b trigramQuery) trigramQuery {
+	switch {
+	case a == nil:
+		return b
+	case b == nil || len(a)*len(b) > maxQuerySets:
+		return a
+	}
+	q := make(trigramQuery, 0, len(a)*len(b))
+	for _, x := range a {
+		for _, y := range b {
+			q = append(q, append(append([]uint32(nil), x...), y...))
+		}
+	}
+	return q
+}
+
+// literalQuery needs the trigrams of the runs of the literal which are
+// matched by the same bytes, lowercased, that files are indexed by. Folded
+// runes which match non-ASCII runes too, such as k and the Kelvin sign,
+// break the runs.
+func literalQuery(lit []rune, fold bool) trigramQuery {
+	var all []uint32
+	var run []byte
+	flush := func() {
+		for i := 0; i+3 <= len(run); i++ {
+			all = append(all, uint32(run[i])<<16|uint32(run[i+1])<<8|uint32(run[i+2]))
+		}
+		run = run[:0]
+	}
+	for _, r := range lit {
+		if fold && !foldsASCII(r) {
+			flush()
+			continue
+		}
+		var enc [utf8.UTFMax]byte
+		for _, c := range enc[:utf8.EncodeRune(enc[:], r)] {
+			run = append(run, lowerASCII(c))
+		}
+	}
+	flush()
+	if all == nil {
+		return nil
+	}
+	return trigramQuery{all}
+}
+
+// foldsASCII reports whether r only folds to ASCII runes, or to none.
+func foldsASCII(r rune) bool {
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		if f >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return r < utf8.RuneSelf || unicode.SimpleFold(r) == r
+}
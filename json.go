@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// The schema IDs of the -json records. Each record has its ID in its schema
+// field, which only changes when a field changes incompatibly. Fields may
+// be added within a version, so readers should ignore those they do not
+// know. gred schema prints the JSON Schema of each.
+const (
+	matchSchemaID = "gred/match/v1"
+	patchSchemaID = "gred/patch/v1"
+	watchSchemaID = "gred/watch/v1"
+)
+
+// matchRecord is one line of search output.
+type matchRecord struct {
+	Schema string `json:"schema"`
+	// Kind is one of the matchKinds
+	Kind string `json:"kind"`
+	// First is set on the first line printed for a file
+	First bool   `json:"first,omitempty"`
+	Path  string `json:"path"`
+	Line  int    `json:"line"`
+	// EndLine is the last line of a -multiline match, whose text then has
+	// a newline between each line
+	EndLine int `json:"end_line,omitempty"`
+	// Column and End are the byte columns of the text with -o, counting
+	// from 1 with End just past it. Column is that of the first match with
+	// -column.
+	Column int `json:"column,omitempty"`
+	End    int `json:"end,omitempty"`
+	// Offset is the byte offset in the file of the line, or of the text
+	// with -o, with -byte-offset
+	Offset *int `json:"offset,omitempty"`
+	// CRC is the ascii85 CRC32 of the original line, as in the text output.
+	// Above and Below are those of anchoring neighbour lines, which are
+	// blank where there is none.
+	CRC   string `json:"crc"`
+	Above string `json:"above,omitempty"`
+	Below string `json:"below,omitempty"`
+	// Text is the line, or with -replace the replaced line. Lines which are
+	// not UTF-8 are given in Base64 as Bytes instead.
+	Text  *string `json:"text,omitempty"`
+	Bytes []byte  `json:"bytes,omitempty"`
+	// Matches are where the patterns matched within a match line's text,
+	// which is left out with -replace or -o
+	Matches []matchRange `json:"matches,omitempty"`
+	// Rule is the ID of the rule a match line matched, from -preset, -f or
+	// a config profile, with its severity and message
+	Rule     string `json:"rule,omitempty"`
+	Severity string `json:"severity,omitempty"`
+	Message  string `json:"message,omitempty"`
+	// Blame is who last changed a match line, with -blame
+	Blame *blameLine `json:"blame,omitempty"`
+	// Owners are the CODEOWNERS of the path, with -owners
+	Owners []string `json:"owners,omitempty"`
+}
+
+// matchRange is the byte columns of a match, counting from 1 with End just
+// past it, as with -o.
+type matchRange struct {
+	Column int `json:"column"`
+	End    int `json:"end"`
+}
+
+// matchKinds name the kinds of search output line by their separator.
+var matchKinds = map[rune]string{
+	crcSepLeft:    "match",
+	passSepLeft:   "passthru",
+	anchorSepLeft: "context",
+	funcSepLeft:   "function",
+}
+
+// patchRecord reports what patch mode did with one file.
+type patchRecord struct {
+	Schema string `json:"schema"`
+	Path   string `json:"path"`
+	// Target is the file patched, when path is a symlink to it
+	Target string `json:"target,omitempty"`
+	// Edits counts the lines edited
+	Edits int `json:"edits"`
+	// Shadow is the file written instead with -simulate
+	Shadow string `json:"shadow,omitempty"`
+	// Error is set when the file could not be patched, and it was then
+	// left as it was
+	Error string `json:"error,omitempty"`
+}
+
+// watchRecord is printed by -watch before the records of a file which
+// changed, or for one removed, in place of the comment of the text output.
+type watchRecord struct {
+	Schema string `json:"schema"`
+	// Event is changed, for files added too, or removed
+	Event string `json:"event"`
+	Path  string `json:"path"`
+}
+
+func printMatchJSON(w io.Writer, first bool, sepLeft rune, path string, pos recordPos, line, crc, above, below []byte, r *rule, bl *blameLine, owners []string, ms []lineMatch, where jsonPos) {
+	rec := matchRecord{
+		Schema:  matchSchemaID,
+		Kind:    matchKinds[sepLeft],
+		First:   first,
+		Path:    path,
+		Line:    pos.lineno,
+		EndLine: pos.endLine,
+		CRC:     string(crc),
+		Above:   string(above),
+		Below:   string(below),
+		Blame:   bl,
+		Owners:  owners,
+	}
+	if pos.cols != nil {
+		rec.Column, rec.End = pos.cols[0]+1, pos.cols[1]+1
+	} else if where.column {
+		rec.Column = pos.column
+	}
+	if where.offset {
+		rec.Offset = &pos.offset
+	}
+	for _, m := range ms {
+		rec.Matches = append(rec.Matches, matchRange{m.idx[0] + 1, m.idx[1] + 1})
+	}
+	if r != nil {
+		rec.Rule, rec.Severity, rec.Message = r.ID, r.Severity, r.Message
+		if rec.Message == "" {
+			rec.Message = r.Description
+		}
+	}
+	if utf8.Valid(line) {
+		text := string(line)
+		rec.Text = &text
+	} else {
+		rec.Bytes = line
+	}
+	printJSON(w, rec)
+}
+
+// jsonPos says which of the positions of -column and -byte-offset a record
+// has.
+type jsonPos struct {
+	column, offset bool
+}
+
+func printPatchJSON(w io.Writer, p *patch, shadow string, err error) {
+	rec := patchRecord{Schema: patchSchemaID, Path: p.path, Edits: len(p.lines), Shadow: shadow}
+	if abs, err := filepath.Abs(p.path); err == nil && p.target != "" && abs != p.target {
+		rec.Target = p.target
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	printJSON(w, rec)
+}
+
+// printJSON prints v as one line of JSON, leaving <, > and & as they are
+// since code is full of them.
+func printJSON(w io.Writer, v interface{}) {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	// the records only hold strings and numbers, so cannot fail to encode
+	enc.Encode(v)
+}
+
+// schemaMode prints the JSON Schema of the -json records.
+func schemaMode(args []string) {
+	if len(args) != 0 {
+		warn("schema does not accept arguments")
+		usage()
+	}
+	kinds := make([]string, 0, len(matchKinds))
+	for _, sep := range []rune{crcSepLeft, passSepLeft, anchorSepLeft, funcSepLeft} {
+		kinds = append(kinds, `"`+matchKinds[sep]+`"`)
+	}
+	fmt.Printf(jsonSchema, matchSchemaID, matchSchemaID, strings.Join(kinds, ", "),
+		patchSchemaID, patchSchemaID, watchSchemaID, watchSchemaID)
+}
+
+const jsonSchema = `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "oneOf": [
+    {
+      "$id": "%s",
+      "type": "object",
+      "required": ["schema", "kind", "path", "line", "crc"],
+      "properties": {
+        "schema": {"const": "%s"},
+        "kind": {"enum": [%s]},
+        "first": {"type": "boolean"},
+        "path": {"type": "string"},
+        "line": {"type": "integer", "minimum": 1},
+        "end_line": {"type": "integer", "minimum": 2},
+        "column": {"type": "integer", "minimum": 1},
+        "end": {"type": "integer", "minimum": 2},
+        "offset": {"type": "integer", "minimum": 0},
+        "crc": {"type": "string", "minLength": 5, "maxLength": 5},
+        "above": {"type": "string", "minLength": 5, "maxLength": 5},
+        "below": {"type": "string", "minLength": 5, "maxLength": 5},
+        "text": {"type": "string"},
+        "bytes": {"type": "string", "contentEncoding": "base64"},
+        "matches": {
+          "type": "array",
+          "items": {
+            "type": "object",
+            "required": ["column", "end"],
+            "properties": {
+              "column": {"type": "integer", "minimum": 1},
+              "end": {"type": "integer", "minimum": 2}
+            }
+          }
+        },
+        "rule": {"type": "string"},
+        "severity": {"enum": ["error", "warning", "note"]},
+        "message": {"type": "string"},
+        "blame": {
+          "type": "object",
+          "required": ["commit", "author", "time"],
+          "properties": {
+            "commit": {"type": "string"},
+            "author": {"type": "string"},
+            "mail": {"type": "string"},
+            "time": {"type": "string", "format": "date-time"}
+          }
+        },
+        "owners": {"type": "array", "items": {"type": "string"}}
+      }
+    },
+    {
+      "$id": "%s",
+      "type": "object",
+      "required": ["schema", "path", "edits"],
+      "properties": {
+        "schema": {"const": "%s"},
+        "path": {"type": "string"},
+        "target": {"type": "string"},
+        "edits": {"type": "integer", "minimum": 0},
+        "shadow": {"type": "string"},
+        "error": {"type": "string"}
+      }
+    },
+    {
+      "$id": "%s",
+      "type": "object",
+      "required": ["schema", "event", "path"],
+      "properties": {
+        "schema": {"const": "%s"},
+        "event": {"enum": ["changed", "removed"]},
+        "path": {"type": "string"}
+      }
+    }
+  ]
+}
+`
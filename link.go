@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// defaultLinkTemplate opens the file itself, which terminals hand to the
+// program the desktop opens files with.
+const defaultLinkTemplate = "file://{host}{path}"
+
+// linker makes the paths of search output into OSC 8 hyperlinks with
+// -hyperlink, to the URL of GRED_HYPERLINK with {path}, {line}, {column}
+// and {host} filled in. An editor may then be opened at the line, as with
+// vscode://file{path}:{line}:{column}. Like colors these are only for a
+// terminal, since the output cannot then be patched.
+type linker struct {
+	template, host string
+}
+
+func newLinker() *linker {
+	l := &linker{template: os.Getenv("GRED_HYPERLINK")}
+	if l.template == "" {
+		l.template = defaultLinkTemplate
+	}
+	// file URLs name the host, so that links from ssh sessions are not
+	// opened on the wrong machine
+	l.host, _ = os.Hostname()
+	return l
+}
+
+// link wraps text in a hyperlink to the line and column of path, which is
+// relative to the current directory.
+func (l *linker) link(path string, line, column int, text string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return text
+	}
+	abs = filepath.ToSlash(abs)
+	if !strings.HasPrefix(abs, "/") {
+		// a Windows drive letter
+		abs = "/" + abs
+	}
+	if column < 1 {
+		column = 1
+	}
+	target := strings.NewReplacer(
+		"{path}", (&url.URL{Path: abs}).EscapedPath(),
+		"{line}", strconv.Itoa(line),
+		"{column}", strconv.Itoa(column),
+		"{host}", l.host,
+	).Replace(l.template)
+	return "\x1b]8;;" + target + "\x1b\\" + text + "\x1b]8;;\x1b\\"
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"regexp/syntax"
+)
+
+// finder finds the leftmost match of a pattern, as regexp.Regexp does.
+type finder interface {
+	FindIndex(b []byte) []int
+}
+
+// literalFinder matches one of several literal strings with bytes.Index,
+// which is vectorized on most platforms and much faster than the regexp
+// engine. Like a regexp alternation, the earliest match wins and then the
+// first literal listed.
+type literalFinder [][]byte
+
+func (lits literalFinder) FindIndex(b []byte) []int {
+	var idx []int
+	for _, lit := range lits {
+		end := len(b)
+		if idx != nil {
+			// only earlier matches are any use
+			end = idx[0] + len(lit) - 1
+			if end > len(b) {
+				end = len(b)
+			}
+		}
+		if i := bytes.Index(b[:end], lit); i >= 0 && (idx == nil || i < idx[0]) {
+			idx = []int{i, i + len(lit)}
+		}
+	}
+	return idx
+}
+
+// newFinder returns a literalFinder for patterns which are only literal
+// text or an alternation of it, otherwise re itself.
+func newFinder(re *regexp.Regexp) finder {
+	if re == nil {
+		return nil
+	}
+	tree, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		return re
+	}
+	tree = tree.Simplify()
+	subs := []*syntax.Regexp{tree}
+	if tree.Op == syntax.OpAlternate {
+		subs = tree.Sub
+	}
+	var lits literalFinder
+	for _, sub := range subs {
+		if sub.Op != syntax.OpLiteral || sub.Flags&syntax.FoldCase != 0 {
+			return re
+		}
+		lits = append(lits, []byte(string(sub.Rune)))
+	}
+	return lits
+}
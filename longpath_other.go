@@ -0,0 +1,10 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+// longPath and extendedPath only change paths on Windows, which limits them
+// to MAX_PATH unless they are written in the \\?\ form.
+func longPath(path string) string { return path }
+
+func extendedPath(path string) string { return path }
@@ -0,0 +1,38 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// maxShortPath is the longest path which is safe to give Windows as is,
+// MAX_PATH less room for the 8.3 file name of a directory.
+const maxShortPath = 247
+
+// longPath returns path in the \\?\ form which may exceed MAX_PATH, when it
+// is too long to be used otherwise.
+func longPath(path string) string {
+	if len(path) <= maxShortPath {
+		return path
+	}
+	return extendedPath(path)
+}
+
+// extendedPath returns the absolute \\?\ form of path, whatever its length.
+// Paths joined onto it are then also free of MAX_PATH.
+func extendedPath(path string) string {
+	if strings.HasPrefix(path, `\\?\`) {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if strings.HasPrefix(abs, `\\`) {
+		return `\\?\UNC\` + abs[2:]
+	}
+	return `\\?\` + abs
+}
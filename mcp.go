@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// mcpVersion is the Model Context Protocol version served when the client
+// asks for none, or for one not in mcpVersions.
+const mcpVersion = "2024-11-05"
+
+// mcpVersions are the versions served, and mcpStructured the first whose
+// tool results have structuredContent.
+var mcpVersions = []string{"2024-11-05", "2025-06-18"}
+
+const mcpStructured = "2025-06-18"
+
+// mcpRequest and mcpResponse are the JSON-RPC 2.0 messages of the Model
+// Context Protocol, one to a line of stdin and stdout. Requests without an
+// id are notifications, which are not answered.
+type mcpRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type mcpResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *mcpError       `json:"error,omitempty"`
+}
+
+type mcpError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// The JSON-RPC error codes answered.
+const (
+	mcpParseError    = -32700
+	mcpUnknownMethod = -32601
+	mcpInvalidParams = -32602
+	mcpInternalError = -32603
+)
+
+// mcpTools are the tools listed to clients, search and patch as served
+// over HTTP by -serve.
+var mcpTools = []interface{}{
+	map[string]interface{}{
+		"name": "search",
+		"description": "Search files for regexps, answering with gred's -json match records, " +
+			"or with text output which the patch tool takes once edited.",
+		"inputSchema": json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "patterns": {"type": "array", "items": {"type": "string"}, "description": "Go regexps to search for"},
+    "globs": {"type": "array", "items": {"type": "string"}, "description": "files, directories or globs to search, as @args"},
+    "gredx": {"type": "string", "description": "the files to search as in GREDX, such as .go.!_test.go"},
+    "flags": {"type": "object", "description": "gred flags by name without the dash, such as {\"i\": true, \"C\": 2}"},
+    "text": {"type": "boolean", "description": "answer with the text output, to edit and patch"}
+  }
+}`),
+	},
+	map[string]interface{}{
+		"name":        "patch",
+		"description": "Patch files with edited text output of the search tool, answering with a -json report for each file.",
+		"inputSchema": json.RawMessage(`{
+  "type": "object",
+  "required": ["input"],
+  "properties": {
+    "input": {"type": "string", "description": "the search records, with the text after their prefixes edited"},
+    "flags": {"type": "object", "description": "patch mode flags by name without the dash, such as {\"relocate\": \"global\"}"}
+  }
+}`),
+	},
+}
+
+// mcpMode serves the Model Context Protocol on stdin and stdout, for agents
+// and other tools to search and patch with structured results. The flags
+// and GREDX given are the defaults of each call, as with -serve.
+func mcpMode(args []string) {
+	if len(args) > 0 {
+		die("mcp: takes no arguments, give flags before the command")
+	}
+	sv := newServer()
+	in := bufio.NewReader(os.Stdin)
+	out := bufio.NewWriter(os.Stdout)
+	for {
+		line, err := in.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			if resp := sv.answer(line); resp != nil {
+				printJSON(out, resp)
+				out.Flush()
+			}
+		}
+		if err == io.EOF {
+			return
+		} else if err != nil {
+			die("mcp: %v", err)
+		}
+	}
+}
+
+// answer returns the response to a message, or nil for a notification.
+func (sv *server) answer(line []byte) *mcpResponse {
+	var req mcpRequest
+	if err := json.Unmarshal(line, &req); err != nil {
+		return &mcpResponse{JSONRPC: "2.0", ID: json.RawMessage("null"),
+			Error: &mcpError{mcpParseError, err.Error()}}
+	}
+	if req.ID == nil {
+		return nil
+	}
+	resp := &mcpResponse{JSONRPC: "2.0", ID: req.ID}
+	switch req.Method {
+	case "initialize":
+		var params struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		json.Unmarshal(req.Params, &params)
+		sv.protocol = mcpVersion
+		if oneOf(params.ProtocolVersion, mcpVersions) {
+			sv.protocol = params.ProtocolVersion
+		}
+		resp.Result = map[string]interface{}{
+			"protocolVersion": sv.protocol,
+			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+			"serverInfo":      map[string]string{"name": "gred", "version": "1"},
+		}
+	case "ping":
+		resp.Result = map[string]interface{}{}
+	case "tools/list":
+		resp.Result = map[string]interface{}{"tools": mcpTools}
+	case "tools/call":
+		var params struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			resp.Error = &mcpError{mcpInvalidParams, err.Error()}
+			break
+		}
+		result, err := sv.call(params.Name, params.Arguments)
+		if err != nil {
+			resp.Error = err
+			break
+		}
+		resp.Result = result
+	default:
+		resp.Error = &mcpError{mcpUnknownMethod, fmt.Sprintf("no method %s", req.Method)}
+	}
+	return resp
+}
+
+// call runs a tool. Failures of the search or patch are answered as tool
+// results with isError, for the agent to see, while bad calls are errors.
+// The result is given as JSON text, and as structuredContent too from the
+// version which has it.
+func (sv *server) call(name string, args json.RawMessage) (interface{}, *mcpError) {
+	if len(args) == 0 {
+		args = json.RawMessage("{}")
+	}
+	var resp interface{}
+	var err error
+	switch name {
+	case "search":
+		var req searchRequest
+		if err := json.Unmarshal(args, &req); err != nil {
+			return nil, &mcpError{mcpInvalidParams, err.Error()}
+		}
+		resp, err = sv.search(req)
+	case "patch":
+		var req struct {
+			Input string                 `json:"input"`
+			Flags map[string]interface{} `json:"flags"`
+		}
+		if err := json.Unmarshal(args, &req); err != nil {
+			return nil, &mcpError{mcpInvalidParams, err.Error()}
+		}
+		resp, err = sv.patch(requestFlags(req.Flags), strings.NewReader(req.Input))
+	default:
+		return nil, &mcpError{mcpInvalidParams, fmt.Sprintf("no tool %s", name)}
+	}
+	if err != nil {
+		return map[string]interface{}{
+			"content": []map[string]string{{"type": "text", "text": err.Error()}},
+			"isError": true,
+		}, nil
+	}
+	text, jsonErr := json.Marshal(resp)
+	if jsonErr != nil {
+		return nil, &mcpError{mcpInternalError, jsonErr.Error()}
+	}
+	result := map[string]interface{}{
+		"content": []map[string]string{{"type": "text", "text": string(text)}},
+	}
+	if sv.protocol >= mcpStructured {
+		result["structuredContent"] = resp
+	}
+	return result, nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// TestMCPVersion checks that initialize agrees on a version served, and
+// that tool results only have structuredContent in the versions with it.
+func TestMCPVersion(t *testing.T) {
+	t.Setenv("GRED_CACHE", "-")
+	t.Setenv("GRED_INDEX", "-")
+	call := `{"jsonrpc": "2.0", "id": 2, "method": "tools/call", "params": {"name": "search",
+		"arguments": {"patterns": ["^package main"], "globs": ["mcp.go"]}}}`
+	tests := []struct {
+		asked, agreed string
+		structured    bool
+	}{
+		{"", mcpVersion, false},
+		{"2024-11-05", "2024-11-05", false},
+		{"2025-06-18", "2025-06-18", true},
+		{"2099-01-01", mcpVersion, false},
+	}
+	for _, tt := range tests {
+		sv := newServer()
+		initialize := `{"jsonrpc": "2.0", "id": 1, "method": "initialize", "params": {"protocolVersion": "` + tt.asked + `"}}`
+		resp := sv.answer([]byte(initialize))
+		if got := resp.Result.(map[string]interface{})["protocolVersion"]; got != tt.agreed {
+			t.Errorf("asked for %q, agreed on %q, want %q", tt.asked, got, tt.agreed)
+		}
+		resp = sv.answer([]byte(call))
+		if resp.Error != nil {
+			t.Fatalf("tools/call: %s", resp.Error.Message)
+		}
+		result := resp.Result.(map[string]interface{})
+		if _, ok := result["structuredContent"]; ok != tt.structured || result["isError"] != nil {
+			t.Errorf("%s: tools/call answered %v", tt.agreed, result)
+		}
+	}
+}
+
+// TestMCPRefusesFlags checks that tool calls cannot set the flags which
+// requests to -serve cannot.
+func TestMCPRefusesFlags(t *testing.T) {
+	sv := newServer()
+	args := json.RawMessage(`{"input": "", "flags": {"simulate": "/tmp/x"}}`)
+	result, err := sv.call("patch", args)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	text := result.(map[string]interface{})["content"].([]map[string]string)[0]["text"]
+	if !strings.Contains(text, "-simulate cannot be given") {
+		t.Errorf("patch with -simulate answered %q", text)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"regexp/syntax"
+	"strings"
+	"unicode"
+)
+
+// nfcTable composes the decompositions in nfdTable.
+var nfcTable map[string]rune
+
+func init() {
+	nfcTable = make(map[string]rune, len(nfdTable))
+	for r, d := range nfdTable {
+		nfcTable[d] = r
+	}
+}
+
+// normalizePattern rewrites the literal text of pat so that each accented
+// letter matches both its composed (NFC) and decomposed (NFD) form. The
+// file content is left as is, so match offsets are unaffected.
+func normalizePattern(pat string) (string, error) {
+	re, err := syntax.Parse(pat, syntax.Perl)
+	if err != nil {
+		return "", err
+	}
+	normalizeRegexp(re)
+	return re.String(), nil
+}
+
+func normalizeRegexp(re *syntax.Regexp) {
+	for _, sub := range re.Sub {
+		normalizeRegexp(sub)
+	}
+	if re.Op != syntax.OpLiteral {
+		return
+	}
+	var subs []*syntax.Regexp
+	var lit []rune
+	var changed bool
+	for _, unit := range splitMarks(re.Rune) {
+		nfc, nfd := composeUnit(unit), decomposeUnit(unit)
+		if nfc == nfd {
+			lit = append(lit, unit...)
+			continue
+		}
+		if lit != nil {
+			subs = append(subs, literal(lit, re.Flags))
+			lit = nil
+		}
+		alt := &syntax.Regexp{Op: syntax.OpAlternate, Flags: re.Flags}
+		alt.Sub = []*syntax.Regexp{literal([]rune(nfc), re.Flags), literal([]rune(nfd), re.Flags)}
+		subs = append(subs, alt)
+		changed = true
+	}
+	if !changed {
+		return
+	}
+	if lit != nil {
+		subs = append(subs, literal(lit, re.Flags))
+	}
+	*re = syntax.Regexp{Op: syntax.OpConcat, Flags: re.Flags, Sub: subs}
+}
+
+func literal(runes []rune, flags syntax.Flags) *syntax.Regexp {
+	return &syntax.Regexp{Op: syntax.OpLiteral, Flags: flags, Rune: runes}
+}
+
+// splitMarks splits runes into units of a base rune and the combining
+// marks which follow it.
+func splitMarks(runes []rune) [][]rune {
+	var units [][]rune
+	for i := 0; i < len(runes); {
+		j := i + 1
+		for j < len(runes) && unicode.Is(unicode.Mn, runes[j]) {
+			j++
+		}
+		units = append(units, runes[i:j])
+		i = j
+	}
+	return units
+}
+
+func decomposeUnit(unit []rune) string {
+	var b strings.Builder
+	for _, r := range unit {
+		if d, ok := nfdTable[r]; ok {
+			b.WriteString(d)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func composeUnit(unit []rune) string {
+	if r, ok := nfcTable[decomposeUnit(unit)]; ok {
+		return string(r)
+	}
+	return string(unit)
+}
@@ -0,0 +1,267 @@
+package main
+
+// nfdTable holds the canonical decompositions of the precomposed Latin,
+// Greek and Cyrillic letters, into a base letter and combining marks.
+var nfdTable = map[rune]string{
+	0x00C0: "\u0041\u0300", 0x00C1: "\u0041\u0301", 0x00C2: "\u0041\u0302",
+	0x00C3: "\u0041\u0303", 0x00C4: "\u0041\u0308", 0x00C5: "\u0041\u030a",
+	0x00C7: "\u0043\u0327", 0x00C8: "\u0045\u0300", 0x00C9: "\u0045\u0301",
+	0x00CA: "\u0045\u0302", 0x00CB: "\u0045\u0308", 0x00CC: "\u0049\u0300",
+	0x00CD: "\u0049\u0301", 0x00CE: "\u0049\u0302", 0x00CF: "\u0049\u0308",
+	0x00D1: "\u004e\u0303", 0x00D2: "\u004f\u0300", 0x00D3: "\u004f\u0301",
+	0x00D4: "\u004f\u0302", 0x00D5: "\u004f\u0303", 0x00D6: "\u004f\u0308",
+	0x00D9: "\u0055\u0300", 0x00DA: "\u0055\u0301", 0x00DB: "\u0055\u0302",
+	0x00DC: "\u0055\u0308", 0x00DD: "\u0059\u0301", 0x00E0: "\u0061\u0300",
+	0x00E1: "\u0061\u0301", 0x00E2: "\u0061\u0302", 0x00E3: "\u0061\u0303",
+	0x00E4: "\u0061\u0308", 0x00E5: "\u0061\u030a", 0x00E7: "\u0063\u0327",
+	0x00E8: "\u0065\u0300", 0x00E9: "\u0065\u0301", 0x00EA: "\u0065\u0302",
+	0x00EB: "\u0065\u0308", 0x00EC: "\u0069\u0300", 0x00ED: "\u0069\u0301",
+	0x00EE: "\u0069\u0302", 0x00EF: "\u0069\u0308", 0x00F1: "\u006e\u0303",
+	0x00F2: "\u006f\u0300", 0x00F3: "\u006f\u0301", 0x00F4: "\u006f\u0302",
+	0x00F5: "\u006f\u0303", 0x00F6: "\u006f\u0308", 0x00F9: "\u0075\u0300",
+	0x00FA: "\u0075\u0301", 0x00FB: "\u0075\u0302", 0x00FC: "\u0075\u0308",
+	0x00FD: "\u0079\u0301", 0x00FF: "\u0079\u0308", 0x0100: "\u0041\u0304",
+	0x0101: "\u0061\u0304", 0x0102: "\u0041\u0306", 0x0103: "\u0061\u0306",
+	0x0104: "\u0041\u0328", 0x0105: "\u0061\u0328", 0x0106: "\u0043\u0301",
+	0x0107: "\u0063\u0301", 0x0108: "\u0043\u0302", 0x0109: "\u0063\u0302",
+	0x010A: "\u0043\u0307", 0x010B: "\u0063\u0307", 0x010C: "\u0043\u030c",
+	0x010D: "\u0063\u030c", 0x010E: "\u0044\u030c", 0x010F: "\u0064\u030c",
+	0x0112: "\u0045\u0304", 0x0113: "\u0065\u0304", 0x0114: "\u0045\u0306",
+	0x0115: "\u0065\u0306", 0x0116: "\u0045\u0307", 0x0117: "\u0065\u0307",
+	0x0118: "\u0045\u0328", 0x0119: "\u0065\u0328", 0x011A: "\u0045\u030c",
+	0x011B: "\u0065\u030c", 0x011C: "\u0047\u0302", 0x011D: "\u0067\u0302",
+	0x011E: "\u0047\u0306", 0x011F: "\u0067\u0306", 0x0120: "\u0047\u0307",
+	0x0121: "\u0067\u0307", 0x0122: "\u0047\u0327", 0x0123: "\u0067\u0327",
+	0x0124: "\u0048\u0302", 0x0125: "\u0068\u0302", 0x0128: "\u0049\u0303",
+	0x0129: "\u0069\u0303", 0x012A: "\u0049\u0304", 0x012B: "\u0069\u0304",
+	0x012C: "\u0049\u0306", 0x012D: "\u0069\u0306", 0x012E: "\u0049\u0328",
+	0x012F: "\u0069\u0328", 0x0130: "\u0049\u0307", 0x0134: "\u004a\u0302",
+	0x0135: "\u006a\u0302", 0x0136: "\u004b\u0327", 0x0137: "\u006b\u0327",
+	0x0139: "\u004c\u0301", 0x013A: "\u006c\u0301", 0x013B: "\u004c\u0327",
+	0x013C: "\u006c\u0327", 0x013D: "\u004c\u030c", 0x013E: "\u006c\u030c",
+	0x0143: "\u004e\u0301", 0x0144: "\u006e\u0301", 0x0145: "\u004e\u0327",
+	0x0146: "\u006e\u0327", 0x0147: "\u004e\u030c", 0x0148: "\u006e\u030c",
+	0x014C: "\u004f\u0304", 0x014D: "\u006f\u0304", 0x014E: "\u004f\u0306",
+	0x014F: "\u006f\u0306", 0x0150: "\u004f\u030b", 0x0151: "\u006f\u030b",
+	0x0154: "\u0052\u0301", 0x0155: "\u0072\u0301", 0x0156: "\u0052\u0327",
+	0x0157: "\u0072\u0327", 0x0158: "\u0052\u030c", 0x0159: "\u0072\u030c",
+	0x015A: "\u0053\u0301", 0x015B: "\u0073\u0301", 0x015C: "\u0053\u0302",
+	0x015D: "\u0073\u0302", 0x015E: "\u0053\u0327", 0x015F: "\u0073\u0327",
+	0x0160: "\u0053\u030c", 0x0161: "\u0073\u030c", 0x0162: "\u0054\u0327",
+	0x0163: "\u0074\u0327", 0x0164: "\u0054\u030c", 0x0165: "\u0074\u030c",
+	0x0168: "\u0055\u0303", 0x0169: "\u0075\u0303", 0x016A: "\u0055\u0304",
+	0x016B: "\u0075\u0304", 0x016C: "\u0055\u0306", 0x016D: "\u0075\u0306",
+	0x016E: "\u0055\u030a", 0x016F: "\u0075\u030a", 0x0170: "\u0055\u030b",
+	0x0171: "\u0075\u030b", 0x0172: "\u0055\u0328", 0x0173: "\u0075\u0328",
+	0x0174: "\u0057\u0302", 0x0175: "\u0077\u0302", 0x0176: "\u0059\u0302",
+	0x0177: "\u0079\u0302", 0x0178: "\u0059\u0308", 0x0179: "\u005a\u0301",
+	0x017A: "\u007a\u0301", 0x017B: "\u005a\u0307", 0x017C: "\u007a\u0307",
+	0x017D: "\u005a\u030c", 0x017E: "\u007a\u030c", 0x01A0: "\u004f\u031b",
+	0x01A1: "\u006f\u031b", 0x01AF: "\u0055\u031b", 0x01B0: "\u0075\u031b",
+	0x01CD: "\u0041\u030c", 0x01CE: "\u0061\u030c", 0x01CF: "\u0049\u030c",
+	0x01D0: "\u0069\u030c", 0x01D1: "\u004f\u030c", 0x01D2: "\u006f\u030c",
+	0x01D3: "\u0055\u030c", 0x01D4: "\u0075\u030c", 0x01D5: "\u0055\u0308\u0304",
+	0x01D6: "\u0075\u0308\u0304", 0x01D7: "\u0055\u0308\u0301", 0x01D8: "\u0075\u0308\u0301",
+	0x01D9: "\u0055\u0308\u030c", 0x01DA: "\u0075\u0308\u030c", 0x01DB: "\u0055\u0308\u0300",
+	0x01DC: "\u0075\u0308\u0300", 0x01DE: "\u0041\u0308\u0304", 0x01DF: "\u0061\u0308\u0304",
+	0x01E0: "\u0041\u0307\u0304", 0x01E1: "\u0061\u0307\u0304", 0x01E2: "\u00c6\u0304",
+	0x01E3: "\u00e6\u0304", 0x01E6: "\u0047\u030c", 0x01E7: "\u0067\u030c",
+	0x01E8: "\u004b\u030c", 0x01E9: "\u006b\u030c", 0x01EA: "\u004f\u0328",
+	0x01EB: "\u006f\u0328", 0x01EC: "\u004f\u0328\u0304", 0x01ED: "\u006f\u0328\u0304",
+	0x01EE: "\u01b7\u030c", 0x01EF: "\u0292\u030c", 0x01F0: "\u006a\u030c",
+	0x01F4: "\u0047\u0301", 0x01F5: "\u0067\u0301", 0x01F8: "\u004e\u0300",
+	0x01F9: "\u006e\u0300", 0x01FA: "\u0041\u030a\u0301", 0x01FB: "\u0061\u030a\u0301",
+	0x01FC: "\u00c6\u0301", 0x01FD: "\u00e6\u0301", 0x01FE: "\u00d8\u0301",
+	0x01FF: "\u00f8\u0301", 0x0200: "\u0041\u030f", 0x0201: "\u0061\u030f",
+	0x0202: "\u0041\u0311", 0x0203: "\u0061\u0311", 0x0204: "\u0045\u030f",
+	0x0205: "\u0065\u030f", 0x0206: "\u0045\u0311", 0x0207: "\u0065\u0311",
+	0x0208: "\u0049\u030f", 0x0209: "\u0069\u030f", 0x020A: "\u0049\u0311",
+	0x020B: "\u0069\u0311", 0x020C: "\u004f\u030f", 0x020D: "\u006f\u030f",
+	0x020E: "\u004f\u0311", 0x020F: "\u006f\u0311", 0x0210: "\u0052\u030f",
+	0x0211: "\u0072\u030f", 0x0212: "\u0052\u0311", 0x0213: "\u0072\u0311",
+	0x0214: "\u0055\u030f", 0x0215: "\u0075\u030f", 0x0216: "\u0055\u0311",
+	0x0217: "\u0075\u0311", 0x0218: "\u0053\u0326", 0x0219: "\u0073\u0326",
+	0x021A: "\u0054\u0326", 0x021B: "\u0074\u0326", 0x021E: "\u0048\u030c",
+	0x021F: "\u0068\u030c", 0x0226: "\u0041\u0307", 0x0227: "\u0061\u0307",
+	0x0228: "\u0045\u0327", 0x0229: "\u0065\u0327", 0x022A: "\u004f\u0308\u0304",
+	0x022B: "\u006f\u0308\u0304", 0x022C: "\u004f\u0303\u0304", 0x022D: "\u006f\u0303\u0304",
+	0x022E: "\u004f\u0307", 0x022F: "\u006f\u0307", 0x0230: "\u004f\u0307\u0304",
+	0x0231: "\u006f\u0307\u0304", 0x0232: "\u0059\u0304", 0x0233: "\u0079\u0304",
+	0x0385: "\u00a8\u0301", 0x0386: "\u0391\u0301", 0x0388: "\u0395\u0301",
+	0x0389: "\u0397\u0301", 0x038A: "\u0399\u0301", 0x038C: "\u039f\u0301",
+	0x038E: "\u03a5\u0301", 0x038F: "\u03a9\u0301", 0x0390: "\u03b9\u0308\u0301",
+	0x03AA: "\u0399\u0308", 0x03AB: "\u03a5\u0308", 0x03AC: "\u03b1\u0301",
+	0x03AD: "\u03b5\u0301", 0x03AE: "\u03b7\u0301", 0x03AF: "\u03b9\u0301",
+	0x03B0: "\u03c5\u0308\u0301", 0x03CA: "\u03b9\u0308", 0x03CB: "\u03c5\u0308",
+	0x03CC: "\u03bf\u0301", 0x03CD: "\u03c5\u0301", 0x03CE: "\u03c9\u0301",
+	0x03D3: "\u03d2\u0301", 0x03D4: "\u03d2\u0308", 0x0400: "\u0415\u0300",
+	0x0401: "\u0415\u0308", 0x0403: "\u0413\u0301", 0x0407: "\u0406\u0308",
+	0x040C: "\u041a\u0301", 0x040D: "\u0418\u0300", 0x040E: "\u0423\u0306",
+	0x0419: "\u0418\u0306", 0x0439: "\u0438\u0306", 0x0450: "\u0435\u0300",
+	0x0451: "\u0435\u0308", 0x0453: "\u0433\u0301", 0x0457: "\u0456\u0308",
+	0x045C: "\u043a\u0301", 0x045D: "\u0438\u0300", 0x045E: "\u0443\u0306",
+	0x0476: "\u0474\u030f", 0x0477: "\u0475\u030f", 0x04C1: "\u0416\u0306",
+	0x04C2: "\u0436\u0306", 0x04D0: "\u0410\u0306", 0x04D1: "\u0430\u0306",
+	0x04D2: "\u0410\u0308", 0x04D3: "\u0430\u0308", 0x04D6: "\u0415\u0306",
+	0x04D7: "\u0435\u0306", 0x04DA: "\u04d8\u0308", 0x04DB: "\u04d9\u0308",
+	0x04DC: "\u0416\u0308", 0x04DD: "\u0436\u0308", 0x04DE: "\u0417\u0308",
+	0x04DF: "\u0437\u0308", 0x04E2: "\u0418\u0304", 0x04E3: "\u0438\u0304",
+	0x04E4: "\u0418\u0308", 0x04E5: "\u0438\u0308", 0x04E6: "\u041e\u0308",
+	0x04E7: "\u043e\u0308", 0x04EA: "\u04e8\u0308", 0x04EB: "\u04e9\u0308",
+	0x04EC: "\u042d\u0308", 0x04ED: "\u044d\u0308", 0x04EE: "\u0423\u0304",
+	0x04EF: "\u0443\u0304", 0x04F0: "\u0423\u0308", 0x04F1: "\u0443\u0308",
+	0x04F2: "\u0423\u030b", 0x04F3: "\u0443\u030b", 0x04F4: "\u0427\u0308",
+	0x04F5: "\u0447\u0308", 0x04F8: "\u042b\u0308", 0x04F9: "\u044b\u0308",
+	0x1E00: "\u0041\u0325", 0x1E01: "\u0061\u0325", 0x1E02: "\u0042\u0307",
+	0x1E03: "\u0062\u0307", 0x1E04: "\u0042\u0323", 0x1E05: "\u0062\u0323",
+	0x1E06: "\u0042\u0331", 0x1E07: "\u0062\u0331", 0x1E08: "\u0043\u0327\u0301",
+	0x1E09: "\u0063\u0327\u0301", 0x1E0A: "\u0044\u0307", 0x1E0B: "\u0064\u0307",
+	0x1E0C: "\u0044\u0323", 0x1E0D: "\u0064\u0323", 0x1E0E: "\u0044\u0331",
+	0x1E0F: "\u0064\u0331", 0x1E10: "\u0044\u0327", 0x1E11: "\u0064\u0327",
+	0x1E12: "\u0044\u032d", 0x1E13: "\u0064\u032d", 0x1E14: "\u0045\u0304\u0300",
+	0x1E15: "\u0065\u0304\u0300", 0x1E16: "\u0045\u0304\u0301", 0x1E17: "\u0065\u0304\u0301",
+	0x1E18: "\u0045\u032d", 0x1E19: "\u0065\u032d", 0x1E1A: "\u0045\u0330",
+	0x1E1B: "\u0065\u0330", 0x1E1C: "\u0045\u0327\u0306", 0x1E1D: "\u0065\u0327\u0306",
+	0x1E1E: "\u0046\u0307", 0x1E1F: "\u0066\u0307", 0x1E20: "\u0047\u0304",
+	0x1E21: "\u0067\u0304", 0x1E22: "\u0048\u0307", 0x1E23: "\u0068\u0307",
+	0x1E24: "\u0048\u0323", 0x1E25: "\u0068\u0323", 0x1E26: "\u0048\u0308",
+	0x1E27: "\u0068\u0308", 0x1E28: "\u0048\u0327", 0x1E29: "\u0068\u0327",
+	0x1E2A: "\u0048\u032e", 0x1E2B: "\u0068\u032e", 0x1E2C: "\u0049\u0330",
+	0x1E2D: "\u0069\u0330", 0x1E2E: "\u0049\u0308\u0301", 0x1E2F: "\u0069\u0308\u0301",
+	0x1E30: "\u004b\u0301", 0x1E31: "\u006b\u0301", 0x1E32: "\u004b\u0323",
+	0x1E33: "\u006b\u0323", 0x1E34: "\u004b\u0331", 0x1E35: "\u006b\u0331",
+	0x1E36: "\u004c\u0323", 0x1E37: "\u006c\u0323", 0x1E38: "\u004c\u0323\u0304",
+	0x1E39: "\u006c\u0323\u0304", 0x1E3A: "\u004c\u0331", 0x1E3B: "\u006c\u0331",
+	0x1E3C: "\u004c\u032d", 0x1E3D: "\u006c\u032d", 0x1E3E: "\u004d\u0301",
+	0x1E3F: "\u006d\u0301", 0x1E40: "\u004d\u0307", 0x1E41: "\u006d\u0307",
+	0x1E42: "\u004d\u0323", 0x1E43: "\u006d\u0323", 0x1E44: "\u004e\u0307",
+	0x1E45: "\u006e\u0307", 0x1E46: "\u004e\u0323", 0x1E47: "\u006e\u0323",
+	0x1E48: "\u004e\u0331", 0x1E49: "\u006e\u0331", 0x1E4A: "\u004e\u032d",
+	0x1E4B: "\u006e\u032d", 0x1E4C: "\u004f\u0303\u0301", 0x1E4D: "\u006f\u0303\u0301",
+	0x1E4E: "\u004f\u0303\u0308", 0x1E4F: "\u006f\u0303\u0308", 0x1E50: "\u004f\u0304\u0300",
+	0x1E51: "\u006f\u0304\u0300", 0x1E52: "\u004f\u0304\u0301", 0x1E53: "\u006f\u0304\u0301",
+	0x1E54: "\u0050\u0301", 0x1E55: "\u0070\u0301", 0x1E56: "\u0050\u0307",
+	0x1E57: "\u0070\u0307", 0x1E58: "\u0052\u0307", 0x1E59: "\u0072\u0307",
+	0x1E5A: "\u0052\u0323", 0x1E5B: "\u0072\u0323", 0x1E5C: "\u0052\u0323\u0304",
+	0x1E5D: "\u0072\u0323\u0304", 0x1E5E: "\u0052\u0331", 0x1E5F: "\u0072\u0331",
+	0x1E60: "\u0053\u0307", 0x1E61: "\u0073\u0307", 0x1E62: "\u0053\u0323",
+	0x1E63: "\u0073\u0323", 0x1E64: "\u0053\u0301\u0307", 0x1E65: "\u0073\u0301\u0307",
+	0x1E66: "\u0053\u030c\u0307", 0x1E67: "\u0073\u030c\u0307", 0x1E68: "\u0053\u0323\u0307",
+	0x1E69: "\u0073\u0323\u0307", 0x1E6A: "\u0054\u0307", 0x1E6B: "\u0074\u0307",
+	0x1E6C: "\u0054\u0323", 0x1E6D: "\u0074\u0323", 0x1E6E: "\u0054\u0331",
+	0x1E6F: "\u0074\u0331", 0x1E70: "\u0054\u032d", 0x1E71: "\u0074\u032d",
+	0x1E72: "\u0055\u0324", 0x1E73: "\u0075\u0324", 0x1E74: "\u0055\u0330",
+	0x1E75: "\u0075\u0330", 0x1E76: "\u0055\u032d", 0x1E77: "\u0075\u032d",
+	0x1E78: "\u0055\u0303\u0301", 0x1E79: "\u0075\u0303\u0301", 0x1E7A: "\u0055\u0304\u0308",
+	0x1E7B: "\u0075\u0304\u0308", 0x1E7C: "\u0056\u0303", 0x1E7D: "\u0076\u0303",
+	0x1E7E: "\u0056\u0323", 0x1E7F: "\u0076\u0323", 0x1E80: "\u0057\u0300",
+	0x1E81: "\u0077\u0300", 0x1E82: "\u0057\u0301", 0x1E83: "\u0077\u0301",
+	0x1E84: "\u0057\u0308", 0x1E85: "\u0077\u0308", 0x1E86: "\u0057\u0307",
+	0x1E87: "\u0077\u0307", 0x1E88: "\u0057\u0323", 0x1E89: "\u0077\u0323",
+	0x1E8A: "\u0058\u0307", 0x1E8B: "\u0078\u0307", 0x1E8C: "\u0058\u0308",
+	0x1E8D: "\u0078\u0308", 0x1E8E: "\u0059\u0307", 0x1E8F: "\u0079\u0307",
+	0x1E90: "\u005a\u0302", 0x1E91: "\u007a\u0302", 0x1E92: "\u005a\u0323",
+	0x1E93: "\u007a\u0323", 0x1E94: "\u005a\u0331", 0x1E95: "\u007a\u0331",
+	0x1E96: "\u0068\u0331", 0x1E97: "\u0074\u0308", 0x1E98: "\u0077\u030a",
+	0x1E99: "\u0079\u030a", 0x1E9B: "\u017f\u0307", 0x1EA0: "\u0041\u0323",
+	0x1EA1: "\u0061\u0323", 0x1EA2: "\u0041\u0309", 0x1EA3: "\u0061\u0309",
+	0x1EA4: "\u0041\u0302\u0301", 0x1EA5: "\u0061\u0302\u0301", 0x1EA6: "\u0041\u0302\u0300",
+	0x1EA7: "\u0061\u0302\u0300", 0x1EA8: "\u0041\u0302\u0309", 0x1EA9: "\u0061\u0302\u0309",
+	0x1EAA: "\u0041\u0302\u0303", 0x1EAB: "\u0061\u0302\u0303", 0x1EAC: "\u0041\u0323\u0302",
+	0x1EAD: "\u0061\u0323\u0302", 0x1EAE: "\u0041\u0306\u0301", 0x1EAF: "\u0061\u0306\u0301",
+	0x1EB0: "\u0041\u0306\u0300", 0x1EB1: "\u0061\u0306\u0300", 0x1EB2: "\u0041\u0306\u0309",
+	0x1EB3: "\u0061\u0306\u0309", 0x1EB4: "\u0041\u0306\u0303", 0x1EB5: "\u0061\u0306\u0303",
+	0x1EB6: "\u0041\u0323\u0306", 0x1EB7: "\u0061\u0323\u0306", 0x1EB8: "\u0045\u0323",
+	0x1EB9: "\u0065\u0323", 0x1EBA: "\u0045\u0309", 0x1EBB: "\u0065\u0309",
+	0x1EBC: "\u0045\u0303", 0x1EBD: "\u0065\u0303", 0x1EBE: "\u0045\u0302\u0301",
+	0x1EBF: "\u0065\u0302\u0301", 0x1EC0: "\u0045\u0302\u0300", 0x1EC1: "\u0065\u0302\u0300",
+	0x1EC2: "\u0045\u0302\u0309", 0x1EC3: "\u0065\u0302\u0309", 0x1EC4: "\u0045\u0302\u0303",
+	0x1EC5: "\u0065\u0302\u0303", 0x1EC6: "\u0045\u0323\u0302", 0x1EC7: "\u0065\u0323\u0302",
+	0x1EC8: "\u0049\u0309", 0x1EC9: "\u0069\u0309", 0x1ECA: "\u0049\u0323",
+	0x1ECB: "\u0069\u0323", 0x1ECC: "\u004f\u0323", 0x1ECD: "\u006f\u0323",
+	0x1ECE: "\u004f\u0309", 0x1ECF: "\u006f\u0309", 0x1ED0: "\u004f\u0302\u0301",
+	0x1ED1: "\u006f\u0302\u0301", 0x1ED2: "\u004f\u0302\u0300", 0x1ED3: "\u006f\u0302\u0300",
+	0x1ED4: "\u004f\u0302\u0309", 0x1ED5: "\u006f\u0302\u0309", 0x1ED6: "\u004f\u0302\u0303",
+	0x1ED7: "\u006f\u0302\u0303", 0x1ED8: "\u004f\u0323\u0302", 0x1ED9: "\u006f\u0323\u0302",
+	0x1EDA: "\u004f\u031b\u0301", 0x1EDB: "\u006f\u031b\u0301", 0x1EDC: "\u004f\u031b\u0300",
+	0x1EDD: "\u006f\u031b\u0300", 0x1EDE: "\u004f\u031b\u0309", 0x1EDF: "\u006f\u031b\u0309",
+	0x1EE0: "\u004f\u031b\u0303", 0x1EE1: "\u006f\u031b\u0303", 0x1EE2: "\u004f\u031b\u0323",
+	0x1EE3: "\u006f\u031b\u0323", 0x1EE4: "\u0055\u0323", 0x1EE5: "\u0075\u0323",
+	0x1EE6: "\u0055\u0309", 0x1EE7: "\u0075\u0309", 0x1EE8: "\u0055\u031b\u0301",
+	0x1EE9: "\u0075\u031b\u0301", 0x1EEA: "\u0055\u031b\u0300", 0x1EEB: "\u0075\u031b\u0300",
+	0x1EEC: "\u0055\u031b\u0309", 0x1EED: "\u0075\u031b\u0309", 0x1EEE: "\u0055\u031b\u0303",
+	0x1EEF: "\u0075\u031b\u0303", 0x1EF0: "\u0055\u031b\u0323", 0x1EF1: "\u0075\u031b\u0323",
+	0x1EF2: "\u0059\u0300", 0x1EF3: "\u0079\u0300", 0x1EF4: "\u0059\u0323",
+	0x1EF5: "\u0079\u0323", 0x1EF6: "\u0059\u0309", 0x1EF7: "\u0079\u0309",
+	0x1EF8: "\u0059\u0303", 0x1EF9: "\u0079\u0303", 0x1F00: "\u03b1\u0313",
+	0x1F01: "\u03b1\u0314", 0x1F02: "\u03b1\u0313\u0300", 0x1F03: "\u03b1\u0314\u0300",
+	0x1F04: "\u03b1\u0313\u0301", 0x1F05: "\u03b1\u0314\u0301", 0x1F06: "\u03b1\u0313\u0342",
+	0x1F07: "\u03b1\u0314\u0342", 0x1F08: "\u0391\u0313", 0x1F09: "\u0391\u0314",
+	0x1F0A: "\u0391\u0313\u0300", 0x1F0B: "\u0391\u0314\u0300", 0x1F0C: "\u0391\u0313\u0301",
+	0x1F0D: "\u0391\u0314\u0301", 0x1F0E: "\u0391\u0313\u0342", 0x1F0F: "\u0391\u0314\u0342",
+	0x1F10: "\u03b5\u0313", 0x1F11: "\u03b5\u0314", 0x1F12: "\u03b5\u0313\u0300",
+	0x1F13: "\u03b5\u0314\u0300", 0x1F14: "\u03b5\u0313\u0301", 0x1F15: "\u03b5\u0314\u0301",
+	0x1F18: "\u0395\u0313", 0x1F19: "\u0395\u0314", 0x1F1A: "\u0395\u0313\u0300",
+	0x1F1B: "\u0395\u0314\u0300", 0x1F1C: "\u0395\u0313\u0301", 0x1F1D: "\u0395\u0314\u0301",
+	0x1F20: "\u03b7\u0313", 0x1F21: "\u03b7\u0314", 0x1F22: "\u03b7\u0313\u0300",
+	0x1F23: "\u03b7\u0314\u0300", 0x1F24: "\u03b7\u0313\u0301", 0x1F25: "\u03b7\u0314\u0301",
+	0x1F26: "\u03b7\u0313\u0342", 0x1F27: "\u03b7\u0314\u0342", 0x1F28: "\u0397\u0313",
+	0x1F29: "\u0397\u0314", 0x1F2A: "\u0397\u0313\u0300", 0x1F2B: "\u0397\u0314\u0300",
+	0x1F2C: "\u0397\u0313\u0301", 0x1F2D: "\u0397\u0314\u0301", 0x1F2E: "\u0397\u0313\u0342",
+	0x1F2F: "\u0397\u0314\u0342", 0x1F30: "\u03b9\u0313", 0x1F31: "\u03b9\u0314",
+	0x1F32: "\u03b9\u0313\u0300", 0x1F33: "\u03b9\u0314\u0300", 0x1F34: "\u03b9\u0313\u0301",
+	0x1F35: "\u03b9\u0314\u0301", 0x1F36: "\u03b9\u0313\u0342", 0x1F37: "\u03b9\u0314\u0342",
+	0x1F38: "\u0399\u0313", 0x1F39: "\u0399\u0314", 0x1F3A: "\u0399\u0313\u0300",
+	0x1F3B: "\u0399\u0314\u0300", 0x1F3C: "\u0399\u0313\u0301", 0x1F3D: "\u0399\u0314\u0301",
+	0x1F3E: "\u0399\u0313\u0342", 0x1F3F: "\u0399\u0314\u0342", 0x1F40: "\u03bf\u0313",
+	0x1F41: "\u03bf\u0314", 0x1F42: "\u03bf\u0313\u0300", 0x1F43: "\u03bf\u0314\u0300",
+	0x1F44: "\u03bf\u0313\u0301", 0x1F45: "\u03bf\u0314\u0301", 0x1F48: "\u039f\u0313",
+	0x1F49: "\u039f\u0314", 0x1F4A: "\u039f\u0313\u0300", 0x1F4B: "\u039f\u0314\u0300",
+	0x1F4C: "\u039f\u0313\u0301", 0x1F4D: "\u039f\u0314\u0301", 0x1F50: "\u03c5\u0313",
+	0x1F51: "\u03c5\u0314", 0x1F52: "\u03c5\u0313\u0300", 0x1F53: "\u03c5\u0314\u0300",
+	0x1F54: "\u03c5\u0313\u0301", 0x1F55: "\u03c5\u0314\u0301", 0x1F56: "\u03c5\u0313\u0342",
+	0x1F57: "\u03c5\u0314\u0342", 0x1F59: "\u03a5\u0314", 0x1F5B: "\u03a5\u0314\u0300",
+	0x1F5D: "\u03a5\u0314\u0301", 0x1F5F: "\u03a5\u0314\u0342", 0x1F60: "\u03c9\u0313",
+	0x1F61: "\u03c9\u0314", 0x1F62: "\u03c9\u0313\u0300", 0x1F63: "\u03c9\u0314\u0300",
+	0x1F64: "\u03c9\u0313\u0301", 0x1F65: "\u03c9\u0314\u0301", 0x1F66: "\u03c9\u0313\u0342",
+	0x1F67: "\u03c9\u0314\u0342", 0x1F68: "\u03a9\u0313", 0x1F69: "\u03a9\u0314",
+	0x1F6A: "\u03a9\u0313\u0300", 0x1F6B: "\u03a9\u0314\u0300", 0x1F6C: "\u03a9\u0313\u0301",
+	0x1F6D: "\u03a9\u0314\u0301", 0x1F6E: "\u03a9\u0313\u0342", 0x1F6F: "\u03a9\u0314\u0342",
+	0x1F70: "\u03b1\u0300", 0x1F72: "\u03b5\u0300", 0x1F74: "\u03b7\u0300",
+	0x1F76: "\u03b9\u0300", 0x1F78: "\u03bf\u0300", 0x1F7A: "\u03c5\u0300",
+	0x1F7C: "\u03c9\u0300", 0x1F80: "\u03b1\u0313\u0345", 0x1F81: "\u03b1\u0314\u0345",
+	0x1F82: "\u03b1\u0313\u0300\u0345", 0x1F83: "\u03b1\u0314\u0300\u0345", 0x1F84: "\u03b1\u0313\u0301\u0345",
+	0x1F85: "\u03b1\u0314\u0301\u0345", 0x1F86: "\u03b1\u0313\u0342\u0345", 0x1F87: "\u03b1\u0314\u0342\u0345",
+	0x1F88: "\u0391\u0313\u0345", 0x1F89: "\u0391\u0314\u0345", 0x1F8A: "\u0391\u0313\u0300\u0345",
+	0x1F8B: "\u0391\u0314\u0300\u0345", 0x1F8C: "\u0391\u0313\u0301\u0345", 0x1F8D: "\u0391\u0314\u0301\u0345",
+	0x1F8E: "\u0391\u0313\u0342\u0345", 0x1F8F: "\u0391\u0314\u0342\u0345", 0x1F90: "\u03b7\u0313\u0345",
+	0x1F91: "\u03b7\u0314\u0345", 0x1F92: "\u03b7\u0313\u0300\u0345", 0x1F93: "\u03b7\u0314\u0300\u0345",
+	0x1F94: "\u03b7\u0313\u0301\u0345", 0x1F95: "\u03b7\u0314\u0301\u0345", 0x1F96: "\u03b7\u0313\u0342\u0345",
+	0x1F97: "\u03b7\u0314\u0342\u0345", 0x1F98: "\u0397\u0313\u0345", 0x1F99: "\u0397\u0314\u0345",
+	0x1F9A: "\u0397\u0313\u0300\u0345", 0x1F9B: "\u0397\u0314\u0300\u0345", 0x1F9C: "\u0397\u0313\u0301\u0345",
+	0x1F9D: "\u0397\u0314\u0301\u0345", 0x1F9E: "\u0397\u0313\u0342\u0345", 0x1F9F: "\u0397\u0314\u0342\u0345",
+	0x1FA0: "\u03c9\u0313\u0345", 0x1FA1: "\u03c9\u0314\u0345", 0x1FA2: "\u03c9\u0313\u0300\u0345",
+	0x1FA3: "\u03c9\u0314\u0300\u0345", 0x1FA4: "\u03c9\u0313\u0301\u0345", 0x1FA5: "\u03c9\u0314\u0301\u0345",
+	0x1FA6: "\u03c9\u0313\u0342\u0345", 0x1FA7: "\u03c9\u0314\u0342\u0345", 0x1FA8: "\u03a9\u0313\u0345",
+	0x1FA9: "\u03a9\u0314\u0345", 0x1FAA: "\u03a9\u0313\u0300\u0345", 0x1FAB: "\u03a9\u0314\u0300\u0345",
+	0x1FAC: "\u03a9\u0313\u0301\u0345", 0x1FAD: "\u03a9\u0314\u0301\u0345", 0x1FAE: "\u03a9\u0313\u0342\u0345",
+	0x1FAF: "\u03a9\u0314\u0342\u0345", 0x1FB0: "\u03b1\u0306", 0x1FB1: "\u03b1\u0304",
+	0x1FB2: "\u03b1\u0300\u0345", 0x1FB3: "\u03b1\u0345", 0x1FB4: "\u03b1\u0301\u0345",
+	0x1FB6: "\u03b1\u0342", 0x1FB7: "\u03b1\u0342\u0345", 0x1FB8: "\u0391\u0306",
+	0x1FB9: "\u0391\u0304", 0x1FBA: "\u0391\u0300", 0x1FBC: "\u0391\u0345",
+	0x1FC1: "\u00a8\u0342", 0x1FC2: "\u03b7\u0300\u0345", 0x1FC3: "\u03b7\u0345",
+	0x1FC4: "\u03b7\u0301\u0345", 0x1FC6: "\u03b7\u0342", 0x1FC7: "\u03b7\u0342\u0345",
+	0x1FC8: "\u0395\u0300", 0x1FCA: "\u0397\u0300", 0x1FCC: "\u0397\u0345",
+	0x1FCD: "\u1fbf\u0300", 0x1FCE: "\u1fbf\u0301", 0x1FCF: "\u1fbf\u0342",
+	0x1FD0: "\u03b9\u0306", 0x1FD1: "\u03b9\u0304", 0x1FD2: "\u03b9\u0308\u0300",
+	0x1FD6: "\u03b9\u0342", 0x1FD7: "\u03b9\u0308\u0342", 0x1FD8: "\u0399\u0306",
+	0x1FD9: "\u0399\u0304", 0x1FDA: "\u0399\u0300", 0x1FDD: "\u1ffe\u0300",
+	0x1FDE: "\u1ffe\u0301", 0x1FDF: "\u1ffe\u0342", 0x1FE0: "\u03c5\u0306",
+	0x1FE1: "\u03c5\u0304", 0x1FE2: "\u03c5\u0308\u0300", 0x1FE4: "\u03c1\u0313",
+	0x1FE5: "\u03c1\u0314", 0x1FE6: "\u03c5\u0342", 0x1FE7: "\u03c5\u0308\u0342",
+	0x1FE8: "\u03a5\u0306", 0x1FE9: "\u03a5\u0304", 0x1FEA: "\u03a5\u0300",
+	0x1FEC: "\u03a1\u0314", 0x1FED: "\u00a8\u0300", 0x1FF2: "\u03c9\u0300\u0345",
+	0x1FF3: "\u03c9\u0345", 0x1FF4: "\u03c9\u0301\u0345", 0x1FF6: "\u03c9\u0342",
+	0x1FF7: "\u03c9\u0342\u0345", 0x1FF8: "\u039f\u0300", 0x1FFA: "\u03a9\u0300",
+	0x1FFC: "\u03a9\u0345",
+}
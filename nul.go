@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"io"
+)
+
+// With -z, or -0, each record of search output ends with a NUL instead of a
+// newline, and newlines within paths and lines are escaped as \n, so that
+// backslashes are escaped as \\ too. Patch mode given -z reads records the
+// same way.
+var nulRecords bool
+
+// nulWriter ends records with NULs, for output which has been escaped so
+// that its only newlines end records.
+type nulWriter struct {
+	w io.Writer
+}
+
+func (nw nulWriter) Write(p []byte) (int, error) {
+	return nw.w.Write(bytes.ReplaceAll(p, newline, []byte{0}))
+}
+
+// escapeNul escapes backslashes and newlines in b.
+func escapeNul(b []byte) []byte {
+	if bytes.IndexByte(b, '\\') < 0 && bytes.IndexByte(b, '\n') < 0 {
+		return b
+	}
+	var out bytes.Buffer
+	for _, c := range b {
+		switch c {
+		case '\\':
+			out.WriteString(`\\`)
+		case '\n':
+			out.WriteString(`\n`)
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return out.Bytes()
+}
+
+// unescapeNul undoes escapeNul. Other backslashes are left as they are.
+func unescapeNul(b []byte) []byte {
+	if bytes.IndexByte(b, '\\') < 0 {
+		return b
+	}
+	out := make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		if b[i] == '\\' && i+1 < len(b) {
+			switch b[i+1] {
+			case '\\':
+				out = append(out, '\\')
+				i++
+				continue
+			case 'n':
+				out = append(out, '\n')
+				i++
+				continue
+			}
+		}
+		out = append(out, b[i])
+	}
+	return out
+}
+
+// scanNulRecords splits NUL terminated records, like scanRawLines.
+func scanNulRecords(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, unescapeNul(data[:i]), nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), unescapeNul(data), nil
+	}
+	return 0, nil, nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// outputSize is how much search output is buffered before it is written.
+const outputSize = 64 << 10
+
+// bufferedOutput writes search output to stdout through a buffer, so that
+// searches with many matches are not slowed by a write for each piece of
+// every record. It is locked so that an interrupt may flush it while
+// records are being written.
+type bufferedOutput struct {
+	mu sync.Mutex
+	w  *bufio.Writer
+}
+
+// output is the search output, once a search has begun. On a terminal it
+// is left nil, for matches to be seen as they are found.
+var output *bufferedOutput
+
+func newBufferedOutput(f *os.File) *bufferedOutput {
+	out := &bufferedOutput{w: bufio.NewWriterSize(f, outputSize)}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-sigs
+		out.Flush()
+		// exit as a shell reports a process killed by the signal
+		code := 2
+		if n, ok := sig.(syscall.Signal); ok {
+			code = 128 + int(n)
+		}
+		os.Exit(code)
+	}()
+	return out
+}
+
+func (out *bufferedOutput) Write(p []byte) (int, error) {
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	return out.w.Write(p)
+}
+
+func (out *bufferedOutput) Flush() error {
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	return out.w.Flush()
+}
+
+// flushOutput writes the search output still buffered, before gred exits
+// or writes to stderr after it.
+func flushOutput() {
+	if output != nil {
+		output.Flush()
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// codeOwnersPaths are where GitHub looks for a CODEOWNERS file, in order.
+var codeOwnersPaths = []string{
+	filepath.Join(".github", "CODEOWNERS"),
+	"CODEOWNERS",
+	filepath.Join("docs", "CODEOWNERS"),
+}
+
+// codeOwners are the owners of paths by the rules of a CODEOWNERS file,
+// where the last rule matching a path wins. Paths are relative to the
+// directory the file is for, which is the search root.
+type codeOwners struct {
+	rules []ownerRule
+	// annotate notes the owners of each file above its output, group
+	// counts the matches of each owner
+	annotate, group bool
+	mu              sync.Mutex
+	byPath          map[string][]string
+	tally           map[string]*ownerTally
+}
+
+type ownerRule struct {
+	re     *regexp.Regexp
+	owners []string
+}
+
+type ownerTally struct {
+	matches int
+	files   map[string]bool
+}
+
+// noOwner stands in for the owners of paths no rule gives any to.
+const noOwner = "(unowned)"
+
+func readCodeOwners() (*codeOwners, error) {
+	for _, path := range codeOwnersPaths {
+		f, err := os.Open(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		co, err := parseCodeOwners(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%v", path, err)
+		}
+		return co, nil
+	}
+	return nil, fmt.Errorf("no CODEOWNERS file in %s", strings.Join(codeOwnersPaths, ", "))
+}
+
+func parseCodeOwners(r io.Reader) (*codeOwners, error) {
+	co := &codeOwners{
+		byPath: make(map[string][]string),
+		tally:  make(map[string]*ownerTally),
+	}
+	scan := bufio.NewScanner(r)
+	for lineno := 1; scan.Scan(); lineno++ {
+		fields := strings.Fields(scan.Text())
+		for i, f := range fields {
+			if strings.HasPrefix(f, "#") {
+				fields = fields[:i]
+				break
+			}
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		re, err := regexp.Compile(ownerPattern(fields[0]))
+		if err != nil {
+			return nil, fmt.Errorf("%d: %v", lineno, err)
+		}
+		// a rule without owners leaves its paths unowned
+		co.rules = append(co.rules, ownerRule{re, fields[1:]})
+	}
+	return co, scan.Err()
+}
+
+// ownerPattern translates a CODEOWNERS pattern, which is mostly like a
+// .gitignore one, to a regexp for slash separated paths. A pattern with a
+// slash before its end is rooted, else it matches at any depth. Matching a
+// directory matches everything below it, except where the pattern ends in
+// a wildcard, as docs/* only owns the files directly in docs.
+func ownerPattern(pat string) string {
+	var re strings.Builder
+	trimmed := strings.TrimSuffix(pat, "/")
+	if strings.Contains(trimmed, "/") {
+		re.WriteString("^")
+	} else {
+		re.WriteString("^(?:.*/)?")
+	}
+	trimmed = strings.TrimPrefix(trimmed, "/")
+	for i := 0; i < len(trimmed); i++ {
+		switch {
+		case strings.HasPrefix(trimmed[i:], "**/"):
+			re.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(trimmed[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case trimmed[i] == '*':
+			re.WriteString("[^/]*")
+		case trimmed[i] == '?':
+			re.WriteString("[^/]")
+		default:
+			re.WriteString(regexp.QuoteMeta(trimmed[i : i+1]))
+		}
+	}
+	switch {
+	case strings.HasSuffix(pat, "/"):
+		re.WriteString("/.*$")
+	case strings.HasSuffix(pat, "*"):
+		re.WriteString("$")
+	default:
+		re.WriteString("(?:/.*)?$")
+	}
+	return re.String()
+}
+
+// owners returns the owners of path, which may be absolute with -abs-paths.
+func (co *codeOwners) owners(path string) []string {
+	co.mu.Lock()
+	defer co.mu.Unlock()
+	if owners, ok := co.byPath[path]; ok {
+		return owners
+	}
+	rel := path
+	if filepath.IsAbs(path) {
+		if wd, err := os.Getwd(); err == nil {
+			if r, err := filepath.Rel(wd, path); err == nil {
+				rel = r
+			}
+		}
+	}
+	rel = filepath.ToSlash(filepath.Clean(rel))
+	var owners []string
+	for i := len(co.rules) - 1; i >= 0; i-- {
+		if co.rules[i].re.MatchString(rel) {
+			owners = co.rules[i].owners
+			break
+		}
+	}
+	co.byPath[path] = owners
+	return owners
+}
+
+// count tallies a match in path against each of its owners.
+func (co *codeOwners) count(path string) {
+	owners := co.owners(path)
+	if len(owners) == 0 {
+		owners = []string{noOwner}
+	}
+	co.mu.Lock()
+	defer co.mu.Unlock()
+	for _, owner := range owners {
+		t := co.tally[owner]
+		if t == nil {
+			t = &ownerTally{files: make(map[string]bool)}
+			co.tally[owner] = t
+		}
+		t.matches++
+		t.files[path] = true
+	}
+}
+
+// printOwners notes the owners of path above its output, as a comment
+// which patch mode ignores.
+func printOwners(w io.Writer, owners []string) {
+	if len(owners) == 0 {
+		owners = []string{noOwner}
+	}
+	fmt.Fprintf(w, "# owners: %s\n", strings.Join(owners, " "))
+}
+
+// printTally writes the matches of each owner, most first, as comments.
+func (co *codeOwners) printTally(w io.Writer) {
+	owners := make([]string, 0, len(co.tally))
+	for owner := range co.tally {
+		owners = append(owners, owner)
+	}
+	sort.Slice(owners, func(i, j int) bool {
+		ti, tj := co.tally[owners[i]], co.tally[owners[j]]
+		if ti.matches != tj.matches {
+			return ti.matches > tj.matches
+		}
+		return owners[i] < owners[j]
+	})
+	for _, owner := range owners {
+		t := co.tally[owner]
+		fmt.Fprintf(w, "# %s: %d matches in %d files\n", owner, t.matches, len(t.files))
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"sort"
+	"sync"
+)
+
+// searchParallel searches paths with s.jobs workers. The largest files are
+// searched first, so that the longest searches start early rather than
+// holding up the end of the run. Output is still printed in the order of
+// paths, each file as soon as those before it are done, with those done
+// early waiting in memory; -unordered prints each file as it is done, and
+// ranking waits for every file. Errors are handled by fileError and nothing
+// more is printed after it returns one. Directory grouping and ranking also
+// search files here, even with one job.
+func searchParallel(s *searchConfig, paths []string) error {
+	order := make([]int, len(paths))
+	for i := range paths {
+		order[i] = i
+	}
+	if s.jobs > 1 {
+		sizes := make([]int64, len(paths))
+		for i, path := range paths {
+			if finfo, err := os.Stat(path); err == nil {
+				sizes[i] = finfo.Size()
+			}
+		}
+		sort.SliceStable(order, func(i, j int) bool {
+			return sizes[order[i]] > sizes[order[j]]
+		})
+	}
+
+	type result struct {
+		i   int
+		out bytes.Buffer
+		err error
+	}
+	jobs := make(chan int)
+	results := make(chan *result)
+	var wg sync.WaitGroup
+	for n := 0; n < s.jobs; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				r := &result{i: i}
+				r.err = grep(&r.out, paths[i], s)
+				results <- r
+			}
+		}()
+	}
+	go func() {
+		for _, i := range order {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	var done []*result
+	// groups are kept in the order of paths too, and ranking reorders them
+	if !s.unordered || s.groups != nil || s.rank != nil {
+		done = make([]*result, len(paths))
+	}
+	// next is the first file in order not yet printed
+	next := 0
+	var err error
+	for r := range results {
+		if err != nil {
+			// let the workers finish
+			continue
+		}
+		if err = s.fileError(r.err); err != nil {
+			continue
+		}
+		if done == nil {
+			s.output(paths[r.i], r.out.Bytes())
+			continue
+		}
+		done[r.i] = r
+		for s.rank == nil && next < len(done) && done[next] != nil {
+			s.output(paths[next], done[next].out.Bytes())
+			// printed, so its output can go
+			done[next] = nil
+			next++
+		}
+	}
+	if err != nil || s.rank == nil {
+		return err
+	}
+	for _, i := range s.rank.order(paths) {
+		s.output(paths[i], done[i].out.Bytes())
+	}
+	return nil
+}
+
+// output prints what searching path found, unless it is kept for grouping.
+func (s *searchConfig) output(path string, out []byte) {
+	if s.groups != nil {
+		path = s.displayPath(path)
+		s.mu.Lock()
+		matches := s.groups.counts[path]
+		s.mu.Unlock()
+		s.groups.add(path, out, matches)
+		return
+	}
+	s.stdout.Write(out)
+}
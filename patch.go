@@ -6,6 +6,7 @@ import (
 	"encoding/ascii85"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"hash/crc32"
 	"io"
 	"os"
@@ -13,54 +14,137 @@ import (
 	"regexp"
 	"sort"
 	"strconv"
+	"strings"
+)
+
+// Edited lines are anchored by up to maxAnchors neighbouring lines from the
+// patch on each side. Anchored lines are looked for up to maxDrift lines
+// away when the file no longer matches at their line number.
+const (
+	maxAnchors = 2
+	maxDrift   = 25
 )
 
 var (
-	BadPatchPrefix, BadCRC, UnexpectedEOF, DupPathGroup error
-	patchPrefixRe                                       *regexp.Regexp
+	BadPatchPrefix, BadCRC, BadContext, UnexpectedEOF, DupPathGroup error
+	AmbiguousDrift, DupEditLine, ConflictingEdits, SymlinkPath      error
+	ReadOnlyPath, ChangedPath, ShrunkPath                           error
+	patchPrefixRe                                                   *regexp.Regexp
 )
 
 func init() {
 	BadPatchPrefix = errors.New("CRC32 path:no\\t should prefix each content line")
 	BadCRC = errors.New("file modified at edit line, aborting")
+	BadContext = errors.New("file modified around edit line, aborting")
 	UnexpectedEOF = errors.New("premature end of target file, aborting")
 	DupPathGroup = errors.New("file lines must be grouped by file")
-	patchPrefixRe = regexp.MustCompile("^.(.....)\t([^:]+):([0-9]+)\t")
+	AmbiguousDrift = errors.New("edit line moved and matches in two places, aborting")
+	DupEditLine = errors.New("file line is edited twice, aborting")
+	ConflictingEdits = errors.New("patches edit the line differently")
+	SymlinkPath = errors.New("is a symlink, not following it")
+	ReadOnlyPath = errors.New("is read-only, not patching it without -force-readonly")
+	ChangedPath = errors.New("changed while being patched, leaving the change made to it")
+	ShrunkPath = errors.New("shrank since it was searched")
+	// an edit line's CRC may be followed by those of its neighbours, and
+	// absolute Windows paths begin with a drive letter. -multiline adds
+	// the last line of a span, and -o the columns of the match, after the
+	// line number. The column and byte offset of -column and -byte-offset
+	// which may follow are ignored.
+	// the submatches are numbered by the prefix constants
+	patchPrefixRe = regexp.MustCompile("^.(.....)(?::(.....):(.....))?\t((?:[A-Za-z]:)?[^:]+):([0-9]+)(?:-([0-9]+))?(?::([0-9]+)-([0-9]+))?(?::[0-9]+)?(?:@[0-9]+)?\t")
 }
 
+// The submatches of patchPrefixRe: the CRC of the line and those of its
+// neighbours, the path, the line number and last line of a span, and the
+// columns of -o.
+const (
+	prefixCRC = 1 + iota
+	prefixAbove
+	prefixBelow
+	prefixPath
+	prefixLine
+	prefixEndLine
+	prefixCol
+	prefixColEnd
+)
+
 type patchLine struct {
 	n, srcN int
 	b       []byte
 	crc     uint32
+	edit    bool
+	// src names the patch input, when there are several
+	src string
+	// col and colEnd are the byte columns of the text printed by -o,
+	// counting from 1 with colEnd just past it. col is 0 when b is the
+	// whole line.
+	col, colEnd int
+	// span is how many lines a -multiline edit replaces, when more than
+	// one. b then holds the lines separated by newlines.
+	span int
+	// above and below are the original CRCs of the lines neighbouring an
+	// edit line in the file, nearest first.
+	above, below []uint32
 }
 
 type patch struct {
-	path  string
-	lines []*patchLine
+	path string
+	// target is the absolute path of the file patched, through any
+	// symlinks, by which the edits of paths naming one file are merged
+	target string
+	// lines are the edited lines, all includes those unchanged
+	lines, all []*patchLine
+	// relocate is one of relocateModes, "" means nearby
+	relocate string
+	// noFollow refuses to patch through a symlink rather than patching
+	// the file it links to
+	noFollow bool
+	// forceReadOnly patches read-only files, which are otherwise refused
+	forceReadOnly bool
+	// tempDir is where the patched file is written before it replaces the
+	// original, "" meaning beside it
+	tempDir string
+	// strict refuses to patch a file shorter than the lines edited, rather
+	// than looking for where they moved
+	strict bool
+	// inPlace writes the patched file back over the original rather than
+	// renaming it over
+	inPlace bool
 }
 
-func newPatchLine(crc, lineno, line []byte, srcLineNo int) (*patchLine, error) {
-	var crcMem [4]byte
-	var oldCrc uint32
-	var err error
+// relocateModes say where to look for an edit line which no longer matches
+// at its line number: nowhere, up to maxDrift lines away when anchored, or
+// anywhere in the file so long as it matches in only one place.
+var relocateModes = []string{"off", "nearby", "global"}
 
-	_, _, err = ascii85.Decode(crcMem[:], crc, true)
-	if err != nil {
-		return nil, err
-	}
-	crcBuf := bytes.NewBuffer(crcMem[:])
-	err = binary.Read(crcBuf, binary.BigEndian, &oldCrc)
+// patchOrders say which order files are patched in: that of the input, by
+// path, or smallest file first.
+var patchOrders = []string{"stream", "path", "size"}
+
+// newPatchLine creates a patch line from the patchPrefixRe submatches m of
+// the input line and the rest of the line which follows the prefix.
+func newPatchLine(m [][]byte, line []byte, srcLineNo int) (*patchLine, error) {
+	oldCrc, err := decodeCRC(m[prefixCRC])
 	if err != nil {
 		return nil, err
 	}
-
-	// patch lines without changes are ignored
-	newCrc := crc32.ChecksumIEEE(line)
-	if oldCrc == newCrc {
-		return nil, nil
+	var above, below []uint32
+	for _, anchor := range []struct {
+		b   []byte
+		crc *[]uint32
+	}{{m[prefixAbove], &above}, {m[prefixBelow], &below}} {
+		// blank when there is no neighbouring line
+		if len(bytes.TrimSpace(anchor.b)) == 0 {
+			continue
+		}
+		crc, err := decodeCRC(anchor.b)
+		if err != nil {
+			return nil, err
+		}
+		*anchor.crc = []uint32{crc}
 	}
 
-	j, err := strconv.ParseUint(string(lineno), 10, 32)
+	j, err := strconv.ParseUint(string(m[prefixLine]), 10, 32)
 	if err != nil {
 		return nil, err
 	}
@@ -68,17 +152,335 @@ func newPatchLine(crc, lineno, line []byte, srcLineNo int) (*patchLine, error) {
 		return nil, errors.New("negative line no")
 	}
 
-	return &patchLine{n: int(j), b: line, crc: oldCrc, srcN: srcLineNo}, nil
+	// line belongs to the scanner so must be copied
+	ln := &patchLine{n: int(j), b: append([]byte(nil), line...), crc: oldCrc, srcN: srcLineNo}
+	ln.above, ln.below = above, below
+	if m[prefixEndLine] != nil {
+		end, err := strconv.Atoi(string(m[prefixEndLine]))
+		if err != nil {
+			return nil, err
+		}
+		if end <= ln.n {
+			return nil, errors.New("bad line range")
+		}
+		ln.span = end - ln.n + 1
+	}
+	if m[prefixCol] != nil {
+		col, err := strconv.Atoi(string(m[prefixCol]))
+		if err != nil {
+			return nil, err
+		}
+		colEnd, err := strconv.Atoi(string(m[prefixColEnd]))
+		if err != nil {
+			return nil, err
+		}
+		if col < 1 || colEnd <= col {
+			return nil, errors.New("bad column range")
+		}
+		ln.col, ln.colEnd = col, colEnd
+	}
+	ln.edit = crc32.ChecksumIEEE(line) != oldCrc
+	return ln, nil
+}
+
+// continueSpan adds a line following a -multiline span's first line, after
+// the spanSepLeft prefix.
+func (ln *patchLine) continueSpan(line []byte) error {
+	if ln.span == 0 {
+		return errors.New("span line follows a single line")
+	}
+	ln.b = append(append(ln.b, '\n'), line...)
+	ln.edit = crc32.ChecksumIEEE(ln.b) != ln.crc
+	return nil
+}
+
+// height is how many lines of the file ln replaces.
+func (ln *patchLine) height() int {
+	if ln.span > 0 {
+		return ln.span
+	}
+	return 1
+}
+
+// headedPrefixRe matches the prefix of a record under a heading, up to
+// where its path would be.
+var headedPrefixRe = regexp.MustCompile("^(.(?:.....)(?::.....:.....)?\t)[0-9]+(?:-[0-9]+)?(?::[0-9]+-[0-9]+)?(?::[0-9]+)?(?:@[0-9]+)?\t")
+
+func decodeCRC(b []byte) (uint32, error) {
+	var crcMem [4]byte
+	var crc uint32
+	_, _, err := ascii85.Decode(crcMem[:], b, true)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(bytes.NewBuffer(crcMem[:]), binary.BigEndian, &crc)
+	return crc, err
+}
+
+// anchorEdits returns the edited lines of a patch, anchored by the lines
+// around them in the patch, else by the neighbour CRCs in their prefix.
+// Patch lines without changes are otherwise ignored.
+func anchorEdits(all []*patchLine) []*patchLine {
+	var edits []*patchLine
+	for i, ln := range all {
+		if !ln.edit {
+			continue
+		}
+		var above, below []uint32
+		// only single whole lines can anchor, not spans or the matches of -o
+		for k := i - 1; k >= 0 && i-k <= maxAnchors && all[k].n == ln.n-(i-k) && all[k].col == 0 && all[k].span == 0; k-- {
+			above = append(above, all[k].crc)
+		}
+		last := ln.n + ln.height() - 1
+		for k := i + 1; k < len(all) && k-i <= maxAnchors && all[k].n == last+(k-i) && all[k].col == 0 && all[k].span == 0; k++ {
+			below = append(below, all[k].crc)
+		}
+		if above != nil {
+			ln.above = above
+		}
+		if below != nil {
+			ln.below = below
+		}
+		edits = append(edits, ln)
+	}
+	return edits
 }
 
-// patchInput reads the patch provided as input on standard input.
-// Returns nil, nil when that input is empty.
+// patchInput reads the patch provided as input on standard input, or else
+// from the files named by args. The patches for one path in different
+// files are merged. Returns nil, nil when that input is empty.
 func patchInput(args []string) ([]*patch, error) {
-	if len(args) != 0 {
-		warn("patch mode does not accept arguments")
-		usage()
+	if len(args) == 0 {
+		// read from a terminal, gred would wait for input never typed
+		if stdinIsTerminal() {
+			return nil, errors.New("expected edited gred output on stdin; did you mean gred -p < file?")
+		}
+		all, err := readPatches(os.Stdin)
+		if err != nil {
+			return nil, err
+		}
+		// a path is only given once, but symlinks may name its file again
+		return editPatches(nil, make(map[string]*patch), all, "stdin")
+	}
+	var patches []*patch
+	byPath := make(map[string]*patch)
+	for _, name := range args {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		all, err := readPatches(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		if patches, err = editPatches(patches, byPath, all, name); err != nil {
+			return nil, err
+		}
+	}
+	return patches, nil
+}
+
+// stdinIsTerminal reports whether stdin is a terminal, rather than a file,
+// a pipe, or the null device, which is a character device too.
+func stdinIsTerminal() bool {
+	if !isTerminal(os.Stdin) {
+		return false
+	}
+	finfo, err := os.Stdin.Stat()
+	if null, nullErr := os.Stat(os.DevNull); err == nil && nullErr == nil && os.SameFile(finfo, null) {
+		return false
+	}
+	return true
+}
+
+// editPatches appends those patches in all with edited lines to patches,
+// merging them into the patches already there for the same file when
+// byPath, which is by target, is not nil. src names the input they were
+// read from.
+func editPatches(patches []*patch, byPath map[string]*patch, all []*patch, src string) ([]*patch, error) {
+	for _, p := range all {
+		// all lines may have been skipped
+		if p.lines == nil {
+			continue
+		}
+		for _, ln := range p.lines {
+			ln.src = src
+		}
+		p.target = patchTarget(p.path)
+		if q := byPath[p.target]; q != nil {
+			if q.path != p.path {
+				warn("%s and %s are both %s, merging their edits", q.path, p.path, p.target)
+			}
+			if err := q.merge(p); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if byPath != nil {
+			byPath[p.target] = p
+		}
+		patches = append(patches, p)
+	}
+	return patches, nil
+}
+
+// patchTarget returns the absolute path of the file path names, through
+// any symlinks. Paths which cannot be resolved, such as those of files
+// which are missing, are only made absolute, to fail when patched.
+func patchTarget(path string) string {
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return path
+}
+
+// orderPatches sorts patches into one of patchOrders. Files which cannot be
+// sized are left until last, to fail when they are patched.
+func orderPatches(patches []*patch, order string) {
+	switch order {
+	case "path":
+		sort.SliceStable(patches, func(i, j int) bool {
+			return naturalLess(patches[i].path, patches[j].path)
+		})
+	case "size":
+		sizes := make(map[*patch]int64, len(patches))
+		for _, p := range patches {
+			sizes[p] = -1
+			if fi, err := os.Stat(p.path); err == nil {
+				sizes[p] = fi.Size()
+			}
+		}
+		sort.SliceStable(patches, func(i, j int) bool {
+			a, b := sizes[patches[i]], sizes[patches[j]]
+			if a < 0 || b < 0 {
+				return b < 0 && a >= 0
+			}
+			return a < b
+		})
+	}
+}
+
+// merge adds the edited lines of q to p. An edit made in both is only kept
+// once, while different edits of the same line, or of the same columns of
+// it, conflict.
+func (p *patch) merge(q *patch) error {
+	type lineCol struct{ n, col int }
+	at := make(map[lineCol]*patchLine, len(p.lines))
+	for _, ln := range p.lines {
+		at[lineCol{ln.n, ln.col}] = ln
+	}
+	for _, ln := range q.lines {
+		prev := at[lineCol{ln.n, ln.col}]
+		switch {
+		case prev == nil:
+			p.lines = append(p.lines, ln)
+			at[lineCol{ln.n, ln.col}] = ln
+		case prev.crc == ln.crc && !ln.edit:
+			// an unedited anchor line agrees with anything
+		case prev.crc == ln.crc && !prev.edit:
+			*prev = *ln
+		case prev.crc != ln.crc || prev.colEnd != ln.colEnd || prev.span != ln.span || !bytes.Equal(prev.b, ln.b):
+			if q.path != p.path {
+				return fmt.Errorf("%s:%d %v (%s line %d, %s line %d as %s, both %s)",
+					p.path, ln.n, ConflictingEdits, prev.src, prev.srcN, ln.src, ln.srcN, q.path, p.target)
+			}
+			return fmt.Errorf("%s:%d %v (%s line %d, %s line %d)",
+				p.path, ln.n, ConflictingEdits, prev.src, prev.srcN, ln.src, ln.srcN)
+		}
+	}
+	sort.Slice(p.lines, func(i, j int) bool {
+		return p.lines[i].n < p.lines[j].n
+	})
+	return nil
+}
+
+// maxPatchLine is the longest patch input line which may be read, or line
+// of a streamed file searched, which -max-line can raise.
+var maxPatchLine = 16 << 20
+
+// lineScanner reads patch input lines, counting them so that a line which
+// is too long can be named.
+type lineScanner struct {
+	*bufio.Scanner
+	n int
+	// name is the file read, when it is not stdin, for the lines skipped
+	// with -skip-bad-lines to be named by
+	name string
+	// heading is the path of the last -heading line, and line the one
+	// scanned with it put back into its records
+	heading, line []byte
+}
+
+func newLineScanner(r io.Reader) *lineScanner {
+	scan := bufio.NewScanner(r)
+	scan.Buffer(make([]byte, 64<<10), maxPatchLine)
+	if nulRecords {
+		scan.Split(scanNulRecords)
+	} else {
+		scan.Split(scanRawLines)
+	}
+	return &lineScanner{Scanner: scan}
+}
+
+// Scan reads the next line. The lines which continue a span begin with
+// spanSepLeft and a tab. -heading lines begin with headingSepLeft and a tab,
+// and name the path of the records after them, which leave it out of their
+// prefix. The path is put back as they are scanned, until the next heading.
+func (s *lineScanner) Scan() bool {
+	ok := s.Scanner.Scan()
+	if !ok {
+		return false
+	}
+	s.n++
+	s.line = s.Scanner.Bytes()
+	_, span := cutSep(s.line, spanSepLeft, "\t")
+	if path, ok := cutSep(s.line, headingSepLeft, "\t"); ok {
+		s.heading = append(s.heading[:0], path...)
+	} else if s.heading != nil && !span {
+		if m := headedPrefixRe.FindSubmatchIndex(s.line); m != nil {
+			at := m[3]
+			s.line = append(append(append(append([]byte(nil), s.line[:at]...), s.heading...), ':'), s.line[at:]...)
+		}
+	}
+	return true
+}
+
+func (s *lineScanner) Bytes() []byte {
+	return s.line
+}
+
+func (s *lineScanner) Err() error {
+	err := s.Scanner.Err()
+	if err == bufio.ErrTooLong {
+		err = newPatchInputError(s.n+1, nil,
+			fmt.Errorf("line is longer than %d bytes, use -max-line to raise it", maxPatchLine))
+	}
+	return err
+}
+
+// scanRawLines splits lines at newlines alone, unlike bufio.ScanLines which
+// also drops a carriage return. Matched lines from CRLF files keep theirs.
+func scanRawLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// readPatches reads a patch, returning one for each path even when none of
+// its lines were edited.
+func readPatches(r io.Reader) ([]*patch, error) {
+	scan := newLineScanner(r)
+	if f, ok := r.(*os.File); ok && f != os.Stdin {
+		scan.name = f.Name()
 	}
-	scan := bufio.NewScanner(os.Stdin)
 	if !scan.Scan() {
 		return nil, scan.Err()
 	}
@@ -104,22 +506,93 @@ func patchInput(args []string) ([]*patch, error) {
 
 var seenPath map[string]bool
 
+// recordPath returns the path of a record from the submatches m of its
+// prefix, cleaned as search output paths are, so that ./a.go, a//a.go and
+// b/../a.go are all patched as the one file.
+func recordPath(m [][]byte) string {
+	return filepath.Clean(string(m[prefixPath]))
+}
+
+// skipBadLines leaves out patch lines which cannot be parsed, with a
+// warning, rather than failing all of the input for one line mangled while
+// editing it.
+var skipBadLines bool
+
+// skipBad reports whether the line of err is skipped, warning of it.
+func (s *lineScanner) skipBad(err error) bool {
+	if !skipBadLines {
+		return false
+	}
+	if s.name != "" {
+		warn("%s: %v, skipped it", s.name, err)
+	} else {
+		warn("%v, skipped it", err)
+	}
+	return true
+}
+
+// skipFirst moves on from the first line of a patch once it is skipped.
+func (s *lineScanner) skipFirst() error {
+	if s.Scan() {
+		return nil
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+// ignoredPatchLine reports whether line is not part of the patch: blank
+// lines, # comments and search output trailers. These let the patch be
+// annotated, or lines be disabled, whilst editing it. -heading lines are
+// also left out, the scanner having noted their path.
+func ignoredPatchLine(line []byte) bool {
+	switch {
+	case len(bytes.TrimSpace(line)) == 0:
+		return true
+	case line[0] == '#':
+		return true
+	}
+	_, heading := cutSep(line, headingSepLeft, "\t")
+	_, trailer := cutSep(line, trailerSepLeft, trailerTag)
+	return heading || trailer
+}
+
 // nextPatch reads the next lines where each line belongs to the same file.
-func parseNextPatch(lineno int, scan *bufio.Scanner) (n int, p *patch, err error) {
+func parseNextPatch(lineno int, scan *lineScanner) (n int, p *patch, err error) {
 	line := scan.Bytes()
+	var skipped int
+	for ignoredPatchLine(line) {
+		if !scan.Scan() {
+			if err = scan.Err(); err == nil {
+				err = io.EOF
+			}
+			return skipped + 1, nil, err
+		}
+		skipped++
+		line = scan.Bytes()
+	}
+	lineno += skipped
+	defer func() { n += skipped }()
 	m := patchPrefixRe.FindSubmatch(line)
 	if m == nil {
 		err = newPatchInputError(lineno, line, BadPatchPrefix)
+		if scan.skipBad(err) {
+			n, err = 1, scan.skipFirst()
+		}
 		return
 	}
 	rest := line[len(m[0]):]
-	ln, err := newPatchLine(m[1], m[3], rest, lineno)
+	ln, err := newPatchLine(m, rest, lineno)
 	if err != nil {
 		err = newPatchInputError(lineno, m[0], err)
+		if scan.skipBad(err) {
+			n, err = 1, scan.skipFirst()
+		}
 		return
 	}
 
-	path := string(m[2])
+	path := recordPath(m)
 	if seenPath[path] {
 		err = newPatchInputError(lineno, m[0], DupPathGroup)
 		return
@@ -128,11 +601,12 @@ func parseNextPatch(lineno int, scan *bufio.Scanner) (n int, p *patch, err error
 
 	p = &patch{}
 	p.path = path
-	if ln != nil {
-		p.lines = []*patchLine{ln}
-	}
+	all := []*patchLine{ln}
 
 	var eof bool
+	// dropped is set once a record is skipped, for the rest of its span
+	// lines to be skipped with it
+	dropped := false
 	for n = 1; ; n++ {
 		if !scan.Scan() {
 			if scan.Err() == nil {
@@ -142,25 +616,48 @@ func parseNextPatch(lineno int, scan *bufio.Scanner) (n int, p *patch, err error
 		}
 		line = scan.Bytes()
 		//fmt.Printf("*DBG* %d:%s\n", n, line)
+		if ignoredPatchLine(line) {
+			continue
+		}
+		if rest, ok := cutSep(line, spanSepLeft, "\t"); ok {
+			if dropped {
+				continue
+			}
+			// the scanner's line must be copied, which append does
+			if err = all[len(all)-1].continueSpan(rest); err != nil {
+				if err = newPatchInputError(lineno+n, line, err); scan.skipBad(err) {
+					// a record missing a line would replace the match
+					// without it
+					all, err, dropped = all[:len(all)-1], nil, true
+					continue
+				}
+				return
+			}
+			continue
+		}
 		m = patchPrefixRe.FindSubmatch(line)
 		if m == nil {
-			err = newPatchInputError(lineno+n, line, BadPatchPrefix)
+			if err = newPatchInputError(lineno+n, line, BadPatchPrefix); scan.skipBad(err) {
+				err, dropped = nil, true
+				continue
+			}
 			return
 		}
-		if p.path != string(m[2]) {
+		if p.path != recordPath(m) {
 			// End of grep lines for the original path.
 			// nextPatch must be stopped and called again.
 			break
 		}
 		rest = line[len(m[0]):]
-		ln, err = newPatchLine(m[1], m[3], rest, lineno+n)
-		switch {
-		case err != nil:
-			err = newPatchInputError(lineno+n, m[0], err)
+		ln, err = newPatchLine(m, rest, lineno+n)
+		if err != nil {
+			if err = newPatchInputError(lineno+n, m[0], err); scan.skipBad(err) {
+				err, dropped = nil, true
+				continue
+			}
 			return
-		case ln != nil:
-			p.lines = append(p.lines, ln)
 		}
+		all, dropped = append(all, ln), false
 	}
 	if err = scan.Err(); err != nil {
 		return
@@ -168,11 +665,8 @@ func parseNextPatch(lineno int, scan *bufio.Scanner) (n int, p *patch, err error
 	if eof {
 		err = io.EOF
 	}
-	// all lines may have been skipped
-	if p.lines == nil {
-		p = nil
-		return
-	}
+	p.all = all
+	p.lines = anchorEdits(all)
 	// Ensure lines are in order.
 	sort.Slice(p.lines, func(i, j int) bool {
 		return p.lines[i].n < p.lines[j].n
@@ -184,74 +678,403 @@ func (p patch) Apply() error {
 	var rdr, wtr *os.File
 	var err error
 
-	rdr, err = os.Open(p.path)
+	// the file a symlink points to is patched, so the link is kept
+	path := p.path
+	if finfo, err := os.Lstat(longPath(path)); err == nil && finfo.Mode()&os.ModeSymlink != 0 {
+		if p.noFollow {
+			return fmt.Errorf("%s %v", p.path, SymlinkPath)
+		}
+		if path, err = filepath.EvalSymlinks(longPath(path)); err != nil {
+			return err
+		}
+	}
+	rdr, err = os.Open(longPath(path))
 	if err != nil {
 		return err
 	}
 	defer rdr.Close()
 
-	dir, file := filepath.Split(p.path)
-	wtr, err = os.CreateTemp(dir, file)
+	dir, file := filepath.Split(path)
+	if p.tempDir != "" {
+		dir = p.tempDir
+	}
+	wtr, err = os.CreateTemp(longPath(dir), tempPrefix+file+"-*")
 	if err != nil {
 		return err
 	}
 
-	err = p.pipe(wtr, rdr)
+	// the patched file replaces the original in place, so keeps its mode
+	finfo, err := rdr.Stat()
 	if err != nil {
 		wtr.Close()
 		os.Remove(wtr.Name())
-	} else {
-		err = os.Rename(wtr.Name(), rdr.Name())
+		return err
+	}
+	mode := finfo.Mode().Perm()
+	// renaming over a read-only file succeeds on Unix but fails on Windows,
+	// so they are refused on both unless forced. Forcing makes the file
+	// writable until it is replaced, and the patched file read-only after.
+	readOnly := mode&0200 == 0
+	if readOnly {
+		if !p.forceReadOnly {
+			wtr.Close()
+			os.Remove(wtr.Name())
+			return fmt.Errorf("%s %v", p.path, ReadOnlyPath)
+		}
+		err = os.Chmod(rdr.Name(), mode|0200)
+	}
+	if err == nil {
+		err = wtr.Chmod(mode | 0200)
+	}
+	if err == nil {
+		err = p.pipe(wtr, rdr)
+	}
+	if closeErr := wtr.Close(); err == nil {
+		err = closeErr
+	}
+	// an editor may have saved the file since it was read, which the
+	// rename would undo
+	if err == nil && changedSince(rdr.Name(), finfo) {
+		err = fmt.Errorf("%s %v", p.path, ChangedPath)
+	}
+	// the replacement is a new file, so it is given the extended attributes
+	// of the original, such as its SELinux label, before it takes its place
+	if err == nil && !p.inPlace {
+		if xattrErr := copyXattrs(wtr.Name(), rdr.Name()); xattrErr != nil {
+			err = fmt.Errorf("%s: copying its extended attributes: %v", p.path, xattrErr)
+		}
+	}
+	if err != nil {
+		os.Remove(wtr.Name())
+	} else if p.inPlace {
+		err = p.writeInPlace(rdr.Name(), wtr.Name())
+	} else if err = os.Rename(wtr.Name(), rdr.Name()); err != nil && p.tempDir != "" {
+		// files cannot be renamed onto another file system, so the patched
+		// file is copied over the original instead, which is not atomic
+		err = copyOver(rdr.Name(), wtr.Name())
+		os.Remove(wtr.Name())
+	} else if n := linkCount(finfo); err == nil && n > 1 {
+		// the patched file is a new one, so the other links to the
+		// original are left with it
+		warn("%s had %d hard links, the others still have its content from before patching", p.path, n)
+	}
+	// whether or not it was replaced, the file is left read-only as it was
+	if readOnly {
+		if chmodErr := os.Chmod(rdr.Name(), mode); err == nil {
+			err = chmodErr
+		}
+	}
+	return err
+}
+
+// lastLine returns the number of the last line of the file edited.
+func (p patch) lastLine() int {
+	last := 0
+	for _, ln := range p.lines {
+		if n := ln.n + ln.height() - 1; n > last {
+			last = n
+		}
+	}
+	return last
+}
+
+// writeInPlace copies the patched file over dst and removes it, so that dst
+// keeps its inode, and with it its hard links and the descriptors open on
+// it, which a rename would leave with the original. The original is copied
+// aside first, and copied back should writing over it fail.
+func (p patch) writeInPlace(dst, patched string) error {
+	defer os.Remove(patched)
+	backup, err := os.CreateTemp(filepath.Dir(patched), tempPrefix+filepath.Base(dst)+"-backup-*")
+	if err != nil {
+		return err
+	}
+	backup.Close()
+	if err := copyOver(backup.Name(), dst); err != nil {
+		os.Remove(backup.Name())
+		return err
+	}
+	if err := copyOver(dst, patched); err != nil {
+		if restoreErr := copyOver(dst, backup.Name()); restoreErr != nil {
+			return fmt.Errorf("%v, and restoring it failed: %v, the original is kept in %s", err, restoreErr, backup.Name())
+		}
+		os.Remove(backup.Name())
+		return err
+	}
+	os.Remove(backup.Name())
+	return nil
+}
+
+// copyOver replaces the content of the file dst with that of src.
+func copyOver(dst, src string) error {
+	rdr, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer rdr.Close()
+	wtr, err := os.OpenFile(dst, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(wtr, rdr)
+	if closeErr := wtr.Close(); err == nil {
+		err = closeErr
 	}
 	return err
 }
 
+// changedSince tells whether the file at path is no longer that of finfo,
+// having been written or replaced.
+func changedSince(path string, finfo os.FileInfo) bool {
+	now, err := os.Stat(path)
+	if err != nil {
+		return true
+	}
+	return !os.SameFile(finfo, now) ||
+		!(freshness{finfo.Size(), finfo.ModTime()}).same(freshness{now.Size(), now.ModTime()})
+}
+
+// Simulate writes the patched file under the shadow directory dir instead
+// of replacing the original. Returns the path of the shadow file.
+func (p patch) Simulate(dir string) (string, error) {
+	rel := filepath.Clean(p.path)
+	if filepath.IsAbs(rel) {
+		rel = strings.TrimLeft(rel[len(filepath.VolumeName(rel)):], `/\`)
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errors.New("cannot simulate patching outside the current directory")
+	}
+	shadow := filepath.Join(dir, rel)
+
+	rdr, err := os.Open(longPath(p.path))
+	if err != nil {
+		return shadow, err
+	}
+	defer rdr.Close()
+	finfo, err := rdr.Stat()
+	if err != nil {
+		return shadow, err
+	}
+	if err = os.MkdirAll(longPath(filepath.Dir(shadow)), 0777); err != nil {
+		return shadow, err
+	}
+	wtr, err := os.OpenFile(longPath(shadow), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, finfo.Mode().Perm())
+	if err != nil {
+		return shadow, err
+	}
+	err = p.pipe(wtr, rdr)
+	if closeErr := wtr.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(longPath(shadow))
+	}
+	return shadow, err
+}
+
 var newline = []byte{'\n'}
 
 func (p patch) pipe(wtr io.Writer, rdr io.Reader) error {
-	buf := bufio.NewReader(rdr)
-	lineno := 1
+	t, err := readTarget(rdr)
+	if err != nil {
+		return err
+	}
+	t.relocate = p.relocate
+	// a file shorter than the lines edited has surely changed, which is
+	// told once rather than as the end of the file being reached early
+	var shrank error
+	if last := p.lastLine(); last > len(t.lines) {
+		shrank = fmt.Errorf("%s %v, to %d lines from at least %d", p.path, ShrunkPath, len(t.lines), last)
+		if p.strict {
+			return shrank
+		}
+	}
+	edits := make(map[int][]*patchLine, len(p.lines))
+	// spanned are the lines after the first of each span edit
+	spanned := make(map[int]bool)
 	for _, ln := range p.lines {
-		for lineno < ln.n {
-			line, err := buf.ReadBytes('\n')
-			if err == io.EOF {
-				err = UnexpectedEOF
+		i, err := t.locate(ln)
+		if err == nil && (overlapsEdit(edits[i], ln) || spanned[i]) {
+			err = DupEditLine
+		}
+		for k := i + 1; err == nil && k < i+ln.height(); k++ {
+			if edits[k] != nil || spanned[k] {
+				err = DupEditLine
 			}
-			if err != nil {
-				return newPatchingError(p.path, lineno, ln.srcN, err)
+		}
+		if err != nil {
+			if shrank != nil && errors.Is(err, UnexpectedEOF) {
+				return shrank
 			}
-			wtr.Write(line)
-			lineno++
+			return newPatchingError(p.path, ln.n, ln.srcN, err)
 		}
-		if err := ln.check(buf); err != nil {
-			return newPatchingError(p.path, lineno, ln.srcN, err)
+		edits[i] = append(edits[i], ln)
+		for k := i + 1; k < i+ln.height(); k++ {
+			spanned[k] = true
 		}
-		wtr.Write(ln.b)
-		wtr.Write(newline)
-		lineno++
+	}
+	if shrank != nil {
+		warn("%v, but the lines edited were found", shrank)
+	}
+	// only edit once every line is known to apply
+	for i, lns := range edits {
+		b := bytes.TrimSuffix(t.lines[i], newline)
+		nl := t.lines[i][len(b):]
+		if ln := lns[0]; ln.span > 0 {
+			// a span keeps the newline of its last line, and the lines
+			// after its first are dropped
+			last := t.lines[i+ln.span-1]
+			nl = last[len(bytes.TrimSuffix(last, newline)):]
+			for k := i + 1; k < i+ln.span; k++ {
+				t.lines[k] = nil
+			}
+			t.lines[i] = append(ln.b, nl...)
+			continue
+		}
+		// splice in -o matches from the last, so earlier columns hold
+		sort.Slice(lns, func(j, k int) bool {
+			return lns[j].col > lns[k].col
+		})
+		for _, ln := range lns {
+			if ln.col == 0 {
+				b = ln.b
+				continue
+			}
+			b = append(append(append([]byte(nil), b[:ln.col-1]...), ln.b...), b[ln.colEnd-1:]...)
+		}
+		t.lines[i] = append(b, nl...)
 	}
 
-	_, err := buf.WriteTo(wtr)
-	return err
+	out := bufio.NewWriter(wtr)
+	for _, line := range t.lines {
+		out.Write(line)
+	}
+	return out.Flush()
 }
 
-func (ln patchLine) check(rdr *bufio.Reader) error {
-	line, err := rdr.ReadBytes('\n')
-	switch err {
-	case nil:
-		i := len(line) - 1
-		if line[i] == '\n' {
-			line = line[:i]
+// overlapsEdit reports whether ln edits any of the same line as lns, which
+// edit columns of the line with -o. Column edits may only share a line
+// when their columns do not overlap.
+func overlapsEdit(lns []*patchLine, ln *patchLine) bool {
+	for _, prev := range lns {
+		if prev.col == 0 || ln.col == 0 || (ln.col < prev.colEnd && prev.col < ln.colEnd) {
+			return true
 		}
-	case io.EOF:
-		return UnexpectedEOF
-	default:
-		return err
 	}
+	return false
+}
+
+// target holds the lines of a file being patched, with their CRCs.
+type target struct {
+	// each line keeps its newline, the last line may lack one
+	lines [][]byte
+	crcs  []uint32
+	// relocate is as in patch
+	relocate string
+}
 
-	crc := crc32.ChecksumIEEE(line)
-	if crc != ln.crc {
+func readTarget(rdr io.Reader) (*target, error) {
+	data, err := io.ReadAll(rdr)
+	if err != nil {
+		return nil, err
+	}
+	t := &target{lines: bytes.SplitAfter(data, newline)}
+	if len(t.lines[len(t.lines)-1]) == 0 {
+		t.lines = t.lines[:len(t.lines)-1]
+	}
+	t.crcs = make([]uint32, len(t.lines))
+	for i, line := range t.lines {
+		t.crcs[i] = crc32.ChecksumIEEE(bytes.TrimSuffix(line, newline))
+	}
+	return t, nil
+}
+
+// locate returns the index of the line ln edits. This is normally its line
+// number but lines are looked for elsewhere as t.relocate allows.
+func (t *target) locate(ln *patchLine) (int, error) {
+	i := ln.n - 1
+	err := t.check(ln, i)
+	switch {
+	case err == nil || t.relocate == "off":
+		return i, err
+	case t.relocate == "global":
+		return t.locateGlobal(ln, i, err)
+	case ln.above == nil && ln.below == nil:
+		return i, err
+	}
+	for d := 1; d <= maxDrift; d++ {
+		up, down := t.check(ln, i-d) == nil, t.check(ln, i+d) == nil
+		switch {
+		case up && down:
+			return i, AmbiguousDrift
+		case up:
+			return i - d, nil
+		case down:
+			return i + d, nil
+		}
+	}
+	return i, err
+}
+
+// locateGlobal looks through the whole file for the one line which ln
+// could edit. err is returned when there is none.
+func (t *target) locateGlobal(ln *patchLine, i int, err error) (int, error) {
+	found := -1
+	for k, crc := range t.crcs {
+		if (ln.col == 0 && ln.span == 0 && crc != ln.crc) || t.check(ln, k) != nil {
+			continue
+		}
+		if found >= 0 {
+			return i, AmbiguousDrift
+		}
+		found = k
+	}
+	if found < 0 {
+		return i, err
+	}
+	return found, nil
+}
+
+// check verifies the CRCs of the line at index i, or of its columns with
+// -o or the lines of its span with -multiline, and of its neighbours when ln
+// is anchored.
+func (t *target) check(ln *patchLine, i int) error {
+	switch {
+	case i < 0:
+		return BadCRC
+	case i+ln.height() > len(t.lines):
+		return UnexpectedEOF
+	case ln.span > 0:
+		if t.spanCRC(i, ln.span) != ln.crc {
+			return BadCRC
+		}
+	case ln.col != 0:
+		b := bytes.TrimSuffix(t.lines[i], newline)
+		if ln.colEnd-1 > len(b) || crc32.ChecksumIEEE(b[ln.col-1:ln.colEnd-1]) != ln.crc {
+			return BadCRC
+		}
+	case t.crcs[i] != ln.crc:
 		return BadCRC
 	}
+	for d, crc := range ln.above {
+		if k := i - 1 - d; k < 0 || t.crcs[k] != crc {
+			return BadContext
+		}
+	}
+	for d, crc := range ln.below {
+		if k := i + ln.height() + d; k >= len(t.lines) || t.crcs[k] != crc {
+			return BadContext
+		}
+	}
 	return nil
 }
+
+// spanCRC is the CRC of n lines from index i, separated by newlines as the
+// search output prints them.
+func (t *target) spanCRC(i, n int) uint32 {
+	crc := crc32.ChecksumIEEE(bytes.TrimSuffix(t.lines[i], newline))
+	for _, line := range t.lines[i+1 : i+n] {
+		crc = crc32.Update(crc, crc32.IEEETable, newline)
+		crc = crc32.Update(crc, crc32.IEEETable, bytes.TrimSuffix(line, newline))
+	}
+	return crc
+}
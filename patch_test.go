@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestPatchExitStatus checks that patch mode exits 2 when a file is not
+// patched, as searching does when a file cannot be read.
+func TestPatchExitStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		// change changes the file searched before it is patched
+		change func(path string) error
+		code   int
+	}{
+		{"patched", func(string) error { return nil }, 0},
+		{"read-only", func(path string) error { return os.Chmod(path, 0444) }, 2},
+		{"stale", func(path string) error { return os.WriteFile(path, []byte("one\ntwo fob\n"), 0644) }, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFiles(t, map[string]string{"a.txt": "one\ntwo foo\n"})
+			out := runGred(t, dir, "", nil, "-replace", "bar", "foo", "@a.txt")
+			if err := tt.change(filepath.Join(dir, "a.txt")); err != nil {
+				t.Fatal(err)
+			}
+			r := runGred(t, dir, out.stdout, nil, "-p")
+			if r.code != tt.code {
+				t.Errorf("exit %d, want %d\n%s", r.code, tt.code, r.stderr)
+			}
+		})
+	}
+}
+
+// TestPatchInPlace checks that -in-place writes the patched content over the
+// file searched, which keeps its inode, and leaves it as it was when it is
+// not patched.
+func TestPatchInPlace(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(path string) error
+		code   int
+		want   string
+	}{
+		{"patched", func(string) error { return nil }, 0, "one\ntwo bar\n"},
+		{"read-only", func(path string) error { return os.Chmod(path, 0444) }, 2, "one\ntwo foo\n"},
+		{"stale", func(path string) error { return os.WriteFile(path, []byte("one\ntwo fob\n"), 0644) }, 2, "one\ntwo fob\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFiles(t, map[string]string{"a.txt": "one\ntwo foo\n"})
+			path := filepath.Join(dir, "a.txt")
+			out := runGred(t, dir, "", nil, "-replace", "bar", "foo", "@a.txt")
+			if err := tt.change(path); err != nil {
+				t.Fatal(err)
+			}
+			before, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := runGred(t, dir, out.stdout, nil, "-p", "-in-place")
+			if r.code != tt.code {
+				t.Errorf("exit %d, want %d\n%s", r.code, tt.code, r.stderr)
+			}
+			after, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !os.SameFile(before, after) {
+				t.Error("the file was replaced")
+			}
+			if got := readTestFile(t, dir, "a.txt"); got != tt.want {
+				t.Errorf("the file has %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestWriteInPlaceRestores checks that the original is kept when writing
+// over it fails, and that its backup is removed.
+func TestWriteInPlaceRestores(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"a.txt": "one\n"})
+	err := patch{path: "a.txt"}.writeInPlace(filepath.Join(dir, "a.txt"), filepath.Join(dir, "missing"))
+	if err == nil {
+		t.Error("writing a missing patched file succeeded")
+	}
+	if got := readTestFile(t, dir, "a.txt"); got != "one\n" {
+		t.Errorf("the file has %q after failing", got)
+	}
+	if names, _ := filepath.Glob(filepath.Join(dir, tempPrefix+"*")); len(names) > 0 {
+		t.Errorf("left %v", names)
+	}
+}
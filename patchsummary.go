@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A patchTree counts the lines patched in each file and directory, to end
+// patch mode with a tree of them as a check the edits landed where they
+// were meant to.
+type patchTree struct {
+	name         string
+	lines, files int
+	children     map[string]*patchTree
+}
+
+func newPatchTree() *patchTree {
+	return &patchTree{children: make(map[string]*patchTree)}
+}
+
+// add counts the lines patched in the file at path.
+func (t *patchTree) add(path string, lines int) {
+	t.lines += lines
+	t.files++
+	path = filepath.ToSlash(filepath.Clean(path))
+	node := t
+	for i, name := range strings.Split(path, "/") {
+		if name == "" && i == 0 {
+			// absolute paths begin at /
+			name = "/"
+		}
+		child := node.children[name]
+		if child == nil {
+			child = &patchTree{name: name, children: make(map[string]*patchTree)}
+			node.children[name] = child
+		}
+		child.lines += lines
+		child.files++
+		node = child
+	}
+}
+
+// report prints the tree to w, in the ASCII of -ascii or else with box
+// drawing, once any file was patched.
+func (t *patchTree) report(w io.Writer, ascii bool) {
+	if t.files == 0 {
+		return
+	}
+	fmt.Fprintf(w, "patched %d line(s) in %d file(s):\n", t.lines, t.files)
+	t.reportChildren(w, "", ascii)
+}
+
+func (t *patchTree) reportChildren(w io.Writer, indent string, ascii bool) {
+	branch, last, down := "├── ", "└── ", "│   "
+	if ascii {
+		branch, last, down = "|-- ", "`-- ", "|   "
+	}
+	names := make([]string, 0, len(t.children))
+	for name := range t.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		child := t.children[name]
+		mark, more := branch, down
+		if i == len(names)-1 {
+			mark, more = last, "    "
+		}
+		if len(child.children) == 0 {
+			fmt.Fprintf(w, "%s%s%s %d\n", indent, mark, name, child.lines)
+			continue
+		}
+		if name != "/" {
+			name += "/"
+		}
+		fmt.Fprintf(w, "%s%s%s %d in %d file(s)\n", indent, mark, name, child.lines, child.files)
+		child.reportChildren(w, indent+more, ascii)
+	}
+}
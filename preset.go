@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+)
+
+// rule is a pattern with metadata shaped like a SARIF reportingDescriptor,
+// so that findings can be reported against it. Rules come from presets,
+// -f files and config profiles.
+type rule struct {
+	ID          string `json:"id"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Severity is one of severities
+	Severity string `json:"severity,omitempty"`
+	// Message is reported with each match, else the description is
+	Message string `json:"message,omitempty"`
+	Pattern string `json:"pattern"`
+	re      *regexp.Regexp
+}
+
+// severities are the SARIF result levels.
+var severities = []string{"error", "warning", "note"}
+
+// presets are curated packs of rules selected with -preset.
+var presets = map[string][]*rule{
+	"secrets": {
+		{
+			ID:          "aws-access-key-id",
+			Name:        "AWS access key ID",
+			Description: "An AWS access key ID, often committed beside its secret key.",
+			Pattern:     `\b(?:AKIA|ASIA|ABIA|ACCA)[0-9A-Z]{16}\b`,
+		},
+		{
+			ID:          "aws-secret-access-key",
+			Name:        "AWS secret access key",
+			Description: "A quoted 40 character key assigned near a mention of an AWS secret.",
+			Pattern:     `(?i)aws.{0,20}(?:secret|private).{0,20}['"][0-9a-z/+]{40}['"]`,
+		},
+		{
+			ID:          "private-key",
+			Name:        "Private key header",
+			Description: "The PEM header of an RSA, EC, DSA, OpenSSH or PGP private key.",
+			Pattern:     `-----BEGIN (?:[A-Z]+ )*PRIVATE KEY(?: BLOCK)?-----`,
+		},
+		{
+			ID:          "bearer-token",
+			Name:        "Bearer token",
+			Description: "An HTTP Authorization bearer token written out in full.",
+			Pattern:     `(?i)\bbearer\s+[a-z0-9._~+/-]{20,}=*`,
+		},
+		{
+			ID:          "github-token",
+			Name:        "GitHub token",
+			Description: "A GitHub personal access, OAuth, app or refresh token.",
+			Pattern:     `\bgh[pousr]_[A-Za-z0-9]{36,}\b`,
+		},
+		{
+			ID:          "slack-token",
+			Name:        "Slack token",
+			Description: "A Slack bot, user, app or refresh token.",
+			Pattern:     `\bxox[abeoprs]-[0-9A-Za-z-]{10,}`,
+		},
+		{
+			ID:          "google-api-key",
+			Name:        "Google API key",
+			Description: "A Google Cloud or Maps API key.",
+			Pattern:     `\bAIza[0-9A-Za-z_-]{35}\b`,
+		},
+	},
+}
+
+func init() {
+	for _, rules := range presets {
+		for _, r := range rules {
+			r.Severity = "error"
+			r.re = regexp.MustCompile(r.Pattern)
+		}
+	}
+}
+
+// pushPreset adds the patterns of the named preset.
+func (cfg *searchConfig) pushPreset(name string) error {
+	rules, ok := presets[name]
+	if !ok {
+		return fmt.Errorf("unknown preset %q, see gred preset", name)
+	}
+	for _, r := range rules {
+		if err := cfg.pushRule(r); err != nil {
+			return fmt.Errorf("preset %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// pushRule adds the pattern of r, whose metadata then goes with the lines
+// it matches.
+func (cfg *searchConfig) pushRule(r *rule) error {
+	if err := cfg.pushPattern(r.Pattern); err != nil {
+		return fmt.Errorf("rule %s: %v", r.ID, err)
+	}
+	if r.re == nil {
+		r.re = regexp.MustCompile(r.Pattern)
+	}
+	cfg.rules = append(cfg.rules, r)
+	return nil
+}
+
+// ruleFor returns the first rule matching line, if any.
+func (cfg *searchConfig) ruleFor(line []byte) *rule {
+	for _, r := range cfg.rules {
+		if r.re.Match(line) {
+			return r
+		}
+	}
+	return nil
+}
+
+// presetMode lists the presets, or prints the rules of one as JSON lines.
+func presetMode(args []string) {
+	switch len(args) {
+	case 0:
+		names := make([]string, 0, len(presets))
+		for name := range presets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("%s\t%d rules\n", name, len(presets[name]))
+		}
+	case 1:
+		rules, ok := presets[args[0]]
+		if !ok {
+			die("unknown preset %q", args[0])
+		}
+		for _, r := range rules {
+			printJSON(os.Stdout, r)
+		}
+	default:
+		warn("preset accepts one preset name")
+		usage()
+	}
+}
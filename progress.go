@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// patchProgress reports to stderr how far patch mode has got through the
+// files, every interval once an apply has run that long, so that a long
+// one can be seen to be alive.
+type patchProgress struct {
+	total, done, failed int
+	interval            time.Duration
+	start, last         time.Time
+}
+
+func newPatchProgress(total int, interval time.Duration) *patchProgress {
+	now := time.Now()
+	return &patchProgress{total: total, interval: interval, start: now, last: now}
+}
+
+// add counts a file patched, or which failed to be.
+func (pp *patchProgress) add(failed bool) {
+	pp.done++
+	if failed {
+		pp.failed++
+	}
+	now := time.Now()
+	if pp.interval <= 0 || now.Sub(pp.last) < pp.interval || pp.done == pp.total {
+		return
+	}
+	pp.last = now
+	// the files left are expected to take as long each as those done
+	elapsed := now.Sub(pp.start)
+	left := elapsed / time.Duration(pp.done) * time.Duration(pp.total-pp.done)
+	fmt.Fprintf(os.Stderr, "progress: %d/%d files, %d failed, about %v left\n",
+		pp.done, pp.total, pp.failed, left.Round(time.Second))
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// ranker scores the files with matches for -rank, like BM25 scores
+// documents for a query: files with more match lines score higher, with
+// diminishing returns, and long files are penalized against the average
+// length of those searched. Recently modified files are then favoured.
+type ranker struct {
+	stats map[string]rankStat
+	// lines and files total what was searched, for the average length
+	lines, files int
+}
+
+type rankStat struct {
+	matches, lines int
+	mtime          time.Time
+}
+
+// The BM25 parameters, and the age at which a file's recency bonus halves.
+const (
+	rankK1       = 1.2
+	rankB        = 0.75
+	rankHalfLife = 90 * 24 * time.Hour
+)
+
+func newRanker() *ranker {
+	return &ranker{stats: make(map[string]rankStat)}
+}
+
+// add records a file searched, which had matches lines matched out of
+// lines. Callers hold the searchConfig mutex.
+func (rk *ranker) add(path string, matches, lines int, mtime time.Time) {
+	rk.lines += lines
+	rk.files++
+	if matches > 0 {
+		rk.stats[path] = rankStat{matches, lines, mtime}
+	}
+}
+
+func (rk *ranker) score(path string, now time.Time) float64 {
+	st, ok := rk.stats[path]
+	if !ok {
+		return 0
+	}
+	avg := float64(rk.lines) / float64(rk.files)
+	tf := float64(st.matches)
+	norm := 1 - rankB + rankB*float64(st.lines)/avg
+	bm25 := tf * (rankK1 + 1) / (tf + rankK1*norm)
+	recency := math.Pow(0.5, float64(now.Sub(st.mtime))/float64(rankHalfLife))
+	return bm25 * (1 + recency)
+}
+
+// order sorts the indexes of paths by descending score, keeping the order
+// of paths between equal scores.
+func (rk *ranker) order(paths []string) []int {
+	now := time.Now()
+	scores := make([]float64, len(paths))
+	idx := make([]int, len(paths))
+	for i, path := range paths {
+		scores[i] = rk.score(path, now)
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool {
+		return scores[idx[i]] > scores[idx[j]]
+	})
+	return idx
+}
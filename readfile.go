@@ -0,0 +1,73 @@
+package main
+
+import (
+	"io"
+	"os"
+)
+
+// Files up to slurpMax bytes are read whole as they come, larger files are
+// streamed, or read into a buffer sized up front when they cannot be, and
+// files from mmapMin bytes on, or all larger files with -mmap, are mapped
+// into memory where the platform allows.
+const (
+	slurpMax = 64 << 10
+	mmapMin  = 64 << 20
+)
+
+// readFile returns a window on the content of f, choosing how to read it
+// by its size and the search. Reads are throttled by -io-limit, and files
+// are then never mapped. release must be called once the content is no
+// longer used.
+func readFile(f *os.File, s *searchConfig) (win *window, release func(), err error) {
+	release = func() {}
+	stream := s.streams()
+	if s.ioLimit != nil {
+		if stream {
+			win, err = newStreamWindow(throttledReader{f, s.ioLimit}, f.Name())
+			return win, release, err
+		}
+		buf, err := io.ReadAll(throttledReader{f, s.ioLimit})
+		return wholeWindow(buf), release, err
+	}
+	finfo, err := f.Stat()
+	if err != nil {
+		return nil, release, err
+	}
+	size := finfo.Size()
+	mapMin := int64(mmapMin)
+	if s.mmap {
+		mapMin = slurpMax + 1
+	}
+	regular := finfo.Mode().IsRegular()
+	if regular && size >= mapMin && int64(int(size)) == size {
+		buf, release, err := mmapFile(f, int(size))
+		if err == nil {
+			return wholeWindow(buf), release, nil
+		}
+		// fall back to reading when mapping fails
+	}
+	var buf []byte
+	switch {
+	case regular && size <= slurpMax:
+		buf, err = io.ReadAll(f)
+	case stream:
+		win, err = newStreamWindow(f, f.Name())
+		return win, release, err
+	case !regular:
+		buf, err = io.ReadAll(f)
+	default:
+		// the file may grow or shrink whilst it is read
+		buf = make([]byte, size, size+1)
+		var n int
+		n, err = io.ReadFull(f, buf)
+		buf = buf[:n]
+		if err == io.ErrUnexpectedEOF {
+			err = nil
+		} else if err == nil {
+			var rest []byte
+			rest, err = io.ReadAll(f)
+			buf = append(buf, rest...)
+		}
+	}
+	return wholeWindow(buf), release, err
+}
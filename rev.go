@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A gitRev reads the files of a git revision for -rev, which are searched
+// rather than those of the working tree, through one git cat-file process.
+// Given a range of commits, the files each commit changes the number of
+// matches in are searched as they were after it, as git log -S finds them.
+type gitRev struct {
+	// files are read at commit, and printed as label:path
+	commit, label string
+	// commits are those of a range, oldest first
+	commits []revCommit
+
+	mu  sync.Mutex
+	cmd *exec.Cmd
+	in  io.WriteCloser
+	out *bufio.Reader
+	// last is the file read last, which the pickaxe reads twice
+	last struct {
+		name string
+		data []byte
+	}
+}
+
+type revCommit struct {
+	hash, short, subject string
+}
+
+// openGitRev starts reading the files of rev, a revision or a range of
+// commits such as v1.0..v2.0.
+func openGitRev(rev string) (*gitRev, error) {
+	g := &gitRev{commit: rev, label: rev}
+	if strings.Contains(rev, "..") {
+		out, err := gitOutput("log", "--no-merges", "--reverse", "--format=%H %h %s", rev, "--")
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range strings.Split(strings.TrimSuffix(string(out), "\n"), "\n") {
+			if f := strings.SplitN(line, " ", 3); len(f) == 3 {
+				g.commits = append(g.commits, revCommit{f[0], f[1], f[2]})
+			}
+		}
+		if g.commits == nil {
+			return nil, fmt.Errorf("-rev %s: no commits in the range", rev)
+		}
+	} else if _, err := gitOutput("rev-parse", "--verify", "--quiet", rev+"^{tree}"); err != nil {
+		return nil, fmt.Errorf("-rev %s: no such revision", rev)
+	}
+	g.cmd = exec.Command("git", "cat-file", "--batch")
+	in, err := g.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	out, err := g.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := g.cmd.Start(); err != nil {
+		return nil, err
+	}
+	g.in, g.out = in, bufio.NewReader(out)
+	return g, nil
+}
+
+// close ends the git cat-file process.
+func (g *gitRev) close() {
+	g.in.Close()
+	g.cmd.Wait()
+}
+
+// read returns the content of the file at path as it was at the commit.
+func (g *gitRev) read(path string) ([]byte, error) {
+	data, ok, err := g.blob(g.commit, path)
+	if err == nil && !ok {
+		err = &fs.PathError{Op: "open", Path: g.label + ":" + filepath.ToSlash(path), Err: fs.ErrNotExist}
+	}
+	return data, err
+}
+
+// blob returns the content of the file at path, relative to the current
+// directory, as it was at rev, reporting false if it had none.
+func (g *gitRev) blob(rev, path string) ([]byte, bool, error) {
+	name := rev + ":./" + filepath.ToSlash(filepath.Clean(path))
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.last.name == name {
+		return g.last.data, g.last.data != nil, nil
+	}
+	if strings.Contains(name, "\n") {
+		return nil, false, nil
+	}
+	if _, err := io.WriteString(g.in, name+"\n"); err != nil {
+		return nil, false, fmt.Errorf("git cat-file: %v", err)
+	}
+	header, err := g.out.ReadString('\n')
+	if err != nil {
+		return nil, false, fmt.Errorf("git cat-file: %v", err)
+	}
+	// the header is the object, its type and size, or the name and missing,
+	// which may have spaces in it
+	if strings.HasSuffix(header, " missing\n") || strings.HasSuffix(header, " ambiguous\n") {
+		return nil, false, nil
+	}
+	f := strings.Fields(header)
+	if len(f) < 3 {
+		return nil, false, fmt.Errorf("git cat-file: bad header %q", header)
+	}
+	typ := f[len(f)-2]
+	size, err := strconv.Atoi(f[len(f)-1])
+	if err != nil {
+		return nil, false, fmt.Errorf("git cat-file: bad header %q", header)
+	}
+	data := make([]byte, size+1)
+	if _, err := io.ReadFull(g.out, data); err != nil {
+		return nil, false, fmt.Errorf("git cat-file: %v", err)
+	}
+	// trees and submodules are not files
+	if typ != "blob" {
+		return nil, false, nil
+	}
+	g.last.name, g.last.data = name, data[:size]
+	return data[:size], true, nil
+}
+
+// files returns the files of the revision under the current directory
+// which the walk would search.
+func (g *gitRev) files(s *searchConfig) ([]string, error) {
+	out, err := gitOutput("ls-tree", "-r", "-z", "--name-only", g.commit)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, path := range strings.Split(string(out), "\x00") {
+		if path = filepath.FromSlash(path); path != "" && s.revSelects(path) {
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
+
+// revSelects reports whether the walk would search path, a file of the
+// revision, by the globs, excludes and directories of GREDX. Files in
+// hidden directories are left out as the walk leaves them.
+func (s *searchConfig) revSelects(path string) bool {
+	dirs := ancestors(filepath.Dir(path))[1:]
+	for _, dir := range dirs {
+		if filepath.Base(dir)[0] == '.' || matchAny(s.skipDirs, dir) {
+			return false
+		}
+	}
+	if s.dirs != nil {
+		within := false
+		for _, root := range s.dirs {
+			within = within || root == "." || strings.HasPrefix(path, root+string(filepath.Separator))
+		}
+		if !within {
+			return false
+		}
+	}
+	name := filepath.Base(path)
+	return !matchAny(s.excludes, name) && matchAny(s.globs, name)
+}
+
+// pickaxe searches the files each commit of the range changed the number
+// of matches in, as they were after it, below comments naming the commit
+// and counting the matches before and after. Files left without matches
+// only have the comment.
+func (g *gitRev) pickaxe(s *searchConfig) error {
+	picked := make(map[string]bool)
+	for _, path := range s.files {
+		picked[filepath.Clean(path)] = true
+	}
+	for _, c := range g.commits {
+		out, err := gitOutput("diff-tree", "-r", "-z", "--root", "--relative", "--no-commit-id", "--name-only", c.hash)
+		if err != nil {
+			return err
+		}
+		headed := false
+		for _, path := range strings.Split(string(out), "\x00") {
+			path = filepath.FromSlash(path)
+			switch {
+			case path == "":
+				continue
+			case s.files != nil && !picked[path]:
+				continue
+			case s.files == nil && !s.revSelects(path):
+				continue
+			}
+			before, _, err := g.blob(c.hash+"^", path)
+			if err != nil {
+				return err
+			}
+			after, _, err := g.blob(c.hash, path)
+			if err != nil {
+				return err
+			}
+			n, m := s.occurrences(before), s.occurrences(after)
+			if n == m {
+				continue
+			}
+			if !headed {
+				fmt.Fprintf(s.stdout, "# commit %s %s\n", c.short, c.subject)
+				headed = true
+			}
+			fmt.Fprintf(s.stdout, "# %s: %d -> %d matches\n", filepath.ToSlash(path), n, m)
+			if m == 0 {
+				continue
+			}
+			g.commit, g.label = c.hash, c.short
+			if err := s.fileError(grep(s.stdout, path, s)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// occurrences counts the matches of the patterns in data, as git log -S
+// counts those of its string.
+func (s *searchConfig) occurrences(data []byte) int {
+	n := 0
+	for _, re := range s.pats {
+		n += len(re.FindAllIndex(data, -1))
+	}
+	return n
+}
+
+// gitOutput runs git with args, returning its output, or an error with
+// what it printed to stderr.
+func gitOutput(args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			return nil, fmt.Errorf("git %s: %v", args[0], err)
+		}
+		return nil, fmt.Errorf("git %s: %v: %s", args[0], err, msg)
+	}
+	return out, nil
+}
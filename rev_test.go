@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRevMissingWithSpace checks that -rev passes over the files missing
+// from a revision whose names have spaces, which git cat-file names in its
+// header.
+func TestRevMissingWithSpace(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("no git")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=gred", "GIT_AUTHOR_EMAIL=gred@example.com",
+			"GIT_COMMITTER_NAME=gred", "GIT_COMMITTER_EMAIL=gred@example.com")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+	git("init", "-q")
+	git("commit", "-q", "--allow-empty", "-m", "one")
+	if err := os.WriteFile(filepath.Join(dir, "a b.txt"), []byte("foo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	git("add", "a b.txt")
+	git("commit", "-q", "-m", "two")
+	r := runGred(t, dir, "", []string{"GREDX=."}, "-rev", "HEAD~1..HEAD", "foo")
+	if r.code != 0 {
+		t.Fatalf("exit %d\n%s", r.code, r.stderr)
+	}
+	if !strings.Contains(r.stdout, ":a b.txt:1\tfoo\n") {
+		t.Errorf("-rev printed\n%s", r.stdout)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// searchOutput, when not nil, is where search output goes instead of
+// stdout: the response of a request being served, or the records to
+// review with -tui.
+var searchOutput io.Writer
+
+// A reviewRecord is a record of search output reviewed with -tui. Records
+// turned off are left out of the patch, and the span lines of -multiline
+// matches are kept after their first line.
+type reviewRecord struct {
+	// prefix is the record up to its text, and loc its path:line
+	prefix, loc, text string
+	spans             []string
+	off               bool
+}
+
+// reviewMode lists the records of the search output out, for lines to be
+// edited or turned off before they are patched, as with gred -p.
+func reviewMode(out []byte) error {
+	recs := reviewRecords(out)
+	if len(recs) == 0 {
+		return nil
+	}
+	tty, err := openTerminal()
+	if err != nil {
+		return fmt.Errorf("-tui needs a terminal: %v", err)
+	}
+	defer tty.Close()
+	if !promptReview(os.Stderr, bufio.NewReader(tty), recs) {
+		return nil
+	}
+	var input bytes.Buffer
+	for _, rec := range recs {
+		if rec.off {
+			continue
+		}
+		input.WriteString(rec.prefix + rec.text + "\n")
+		for _, span := range rec.spans {
+			input.WriteString(span + "\n")
+		}
+	}
+	if err := checkPatchFlags(); err != nil {
+		return err
+	}
+	all, err := readPatches(&input)
+	if err != nil {
+		return err
+	}
+	patches, err := editPatches(nil, make(map[string]*patch), all, "review")
+	switch {
+	case err != nil:
+		return err
+	case patches == nil:
+		warn("no lines were edited, so nothing was patched")
+	default:
+		if failed := patchMode(os.Stdout, patches); failed > 0 {
+			return fmt.Errorf("%d of %d files were not patched", failed, len(patches))
+		}
+	}
+	return nil
+}
+
+// reviewRecords returns the records of search output, leaving out comments
+// and other lines patch mode ignores.
+func reviewRecords(out []byte) []*reviewRecord {
+	var recs []*reviewRecord
+	for _, line := range strings.Split(strings.TrimSuffix(string(out), "\n"), "\n") {
+		if _, span := cutSep([]byte(line), spanSepLeft, "\t"); span && len(recs) > 0 {
+			rec := recs[len(recs)-1]
+			rec.spans = append(rec.spans, line)
+			continue
+		}
+		if ignoredPatchLine([]byte(line)) {
+			continue
+		}
+		m := patchPrefixRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		recs = append(recs, &reviewRecord{prefix: m[0], loc: m[prefixPath] + ":" + m[prefixLine], text: line[len(m[0]):]})
+	}
+	return recs
+}
+
+// promptReview lists the records and takes commands until they are to be
+// patched, reporting true, or the user quits.
+func promptReview(w io.Writer, r *bufio.Reader, recs []*reviewRecord) bool {
+	read := func() (string, bool) {
+		answer, err := r.ReadString('\n')
+		if err != nil && answer == "" {
+			fmt.Fprintln(w)
+			return "", false
+		}
+		return strings.TrimSuffix(strings.TrimSuffix(answer, "\n"), "\r"), true
+	}
+	for {
+		for i, rec := range recs {
+			mark := 'x'
+			if rec.off {
+				mark = ' '
+			}
+			more := ""
+			if len(rec.spans) > 0 {
+				more = fmt.Sprintf(" (and %d more lines)", len(rec.spans))
+			}
+			fmt.Fprintf(w, "[%c] %3d  %s\t%s%s\n", mark, i+1, rec.loc, rec.text, more)
+		}
+		fmt.Fprint(w, "toggle lines (e.g. 2 4-6), e N to edit line N, y to patch, q to quit: ")
+		answer, ok := read()
+		if !ok {
+			return false
+		}
+		switch answer = strings.TrimSpace(answer); {
+		case answer == "y":
+			return true
+		case answer == "q":
+			return false
+		case strings.HasPrefix(answer, "e "):
+			n, err := strconv.Atoi(strings.TrimSpace(answer[2:]))
+			switch {
+			case err != nil || n < 1 || n > len(recs):
+				fmt.Fprintf(w, "%s: no such line\n", answer)
+				continue
+			case len(recs[n-1].spans) > 0:
+				fmt.Fprintf(w, "%d: lines of a -multiline match can only be turned off\n", n)
+				continue
+			}
+			fmt.Fprintf(w, "%s\t%s\nnew text, or nothing to keep it: ", recs[n-1].loc, recs[n-1].text)
+			text, ok := read()
+			if !ok {
+				return false
+			}
+			if text != "" {
+				recs[n-1].text = text
+			}
+			continue
+		}
+		for _, word := range strings.Fields(answer) {
+			lo, hi, err := parseRange(word)
+			if err != nil || lo < 1 || hi > len(recs) || lo > hi {
+				fmt.Fprintf(w, "%s: no such lines\n", word)
+				continue
+			}
+			for i := lo - 1; i < hi; i++ {
+				recs[i].off = !recs[i].off
+			}
+		}
+	}
+}
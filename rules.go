@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// readPatternFile reads the patterns of a -f file, one per line. Blank
+// lines and lines starting with # are ignored. A pattern may be followed
+// by a tab and then, also tab separated, a rule ID, severity and message:
+//
+//	fmt\.Print	no-print	warning	use the logger instead
+func readPatternFile(path string) ([]*rule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var rules []*rule
+	scan := bufio.NewScanner(f)
+	for lineno := 1; scan.Scan(); lineno++ {
+		line := strings.TrimSuffix(scan.Text(), "\r")
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		fields := strings.SplitN(line, "\t", 4)
+		r := &rule{Pattern: fields[0]}
+		if len(fields) > 1 {
+			r.ID = fields[1]
+		}
+		if len(fields) > 2 {
+			r.Severity = fields[2]
+		}
+		if len(fields) > 3 {
+			r.Message = fields[3]
+		}
+		if err := checkRule(r); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, lineno, err)
+		}
+		rules = append(rules, r)
+	}
+	return rules, scan.Err()
+}
+
+// parseRule parses the words of a config rule: an ID, severity, pattern,
+// and the rest of the words as the message.
+func parseRule(words []string) (*rule, error) {
+	if len(words) < 3 {
+		return nil, fmt.Errorf("rule needs an ID, severity and pattern, then a message")
+	}
+	r := &rule{ID: words[0], Severity: words[1], Pattern: words[2], Message: strings.Join(words[3:], " ")}
+	return r, checkRule(r)
+}
+
+func checkRule(r *rule) error {
+	if r.Severity != "" && !oneOf(r.Severity, severities) {
+		return fmt.Errorf("severity must be one of: %s", strings.Join(severities, ", "))
+	}
+	return nil
+}
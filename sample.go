@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// sampler keeps at most n randomly chosen match records of each pattern,
+// for -sample, by reservoir sampling so that every match is as likely to
+// be kept however many there are. Records are printed once the search is
+// done, in the order they were found.
+type sampler struct {
+	n     int
+	rng   *rand.Rand
+	pools []samplePool
+	// seq orders records by when they were found, and pathSeq paths
+	seq     int
+	pathSeq map[string]int
+}
+
+type samplePool struct {
+	// seen counts every match of the pattern
+	seen int
+	kept []sampled
+}
+
+type sampled struct {
+	pathSeq, seq int
+	path         string
+	rec          []byte
+}
+
+func newSampler(n, pats int) *sampler {
+	return &sampler{
+		n:       n,
+		rng:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		pools:   make([]samplePool, pats),
+		pathSeq: make(map[string]int),
+	}
+}
+
+// add offers the record of a match of pattern i in path. Callers hold the
+// searchConfig mutex.
+func (sm *sampler) add(i int, path string, rec []byte) {
+	if _, ok := sm.pathSeq[path]; !ok {
+		sm.pathSeq[path] = len(sm.pathSeq)
+	}
+	sm.seq++
+	pool := &sm.pools[i]
+	pool.seen++
+	k := len(pool.kept)
+	if k >= sm.n {
+		if k = sm.rng.Intn(pool.seen); k >= sm.n {
+			return
+		}
+	}
+	s := sampled{sm.pathSeq[path], sm.seq, path, append([]byte(nil), rec...)}
+	if k == len(pool.kept) {
+		pool.kept = append(pool.kept, s)
+	} else {
+		pool.kept[k] = s
+	}
+}
+
+// print writes the records kept, marking the first of each path, and then
+// comments with how many of the matches of each pattern were kept.
+func (sm *sampler) print(w io.Writer, s *searchConfig) {
+	var all []sampled
+	for _, pool := range sm.pools {
+		all = append(all, pool.kept...)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].pathSeq != all[j].pathSeq {
+			return all[i].pathSeq < all[j].pathSeq
+		}
+		return all[i].seq < all[j].seq
+	})
+	prev := ""
+	for _, smp := range all {
+		rec := smp.rec
+		if smp.path != prev {
+			if s.heading {
+				s.printHeading(w, smp.path)
+			}
+			rec = append([]byte(string(seps.of(firstSepLeft))), bytes.TrimPrefix(rec, []byte(string(seps.of(crcSepLeft))))...)
+			prev = smp.path
+		}
+		w.Write(rec)
+	}
+	for i, pool := range sm.pools {
+		if pool.seen > 0 {
+			fmt.Fprintf(w, "# %s: sampled %d of %d matches\n", s.pats[i], len(pool.kept), pool.seen)
+		}
+	}
+}
+
+// patternOf returns the index of the first pattern matching text.
+func (s *searchConfig) patternOf(text []byte) int {
+	for i, re := range s.pats {
+		if re.Match(text) {
+			return i
+		}
+	}
+	return 0
+}
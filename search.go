@@ -12,13 +12,25 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"regexp/syntax"
+	"sort"
 	"strings"
+	"sync"
+	"time"
+	"unicode"
 )
 
 const (
-	readBufSize  = 1024
-	firstSepLeft = '╓'
-	crcSepLeft   = '║'
+	readBufSize   = 1024
+	firstSepLeft  = '╓'
+	crcSepLeft    = '║'
+	passSepLeft   = '│'
+	anchorSepLeft = '┆'
+	// spanSepLeft begins the lines after the first of a -multiline match
+	spanSepLeft = '┊'
+	// headingSepLeft begins the line naming the path of the records after
+	// it with -heading
+	headingSepLeft = '╔'
 )
 
 var (
@@ -27,24 +39,182 @@ var (
 
 // Patterns can be positive or negative file globs
 type searchConfig struct {
-	globs []string
-	files []string
-	pats  []*regexp.Regexp
+	globs    []string
+	excludes []string
+	files    []string
+	pats     []*regexp.Regexp
+	// finders match pats, faster when they are only literals
+	finders []finder
+	// dirs limits the walk to those directories, skipDirs are never
+	// walked. Both are relative to the search root.
+	dirs, skipDirs []string
+	// ignores, when not nil, skips the files ignored by .gitignore and
+	// .gredignore files
+	ignores *gitIgnores
+	// replace is nil unless replacing matches, in which case the output
+	// is an edit stream ready for patch mode, or a preview of it.
+	replace []byte
+	preview bool
+	// sortBy is empty unless walked files are collected into found and
+	// searched once sorted.
+	sortBy string
+	found  []string
+	// unordered walks directories as the file system lists them, and
+	// prints parallel searches as they finish, rather than in order
+	unordered bool
+	// unique counts matched lines by content instead of printing them,
+	// uniqs keeps the order lines were first seen.
+	unique   bool
+	uniqs    []string
+	uniqSeen map[string]int
+	// only matched lines are shown when previewing or counting
+	passthru, showFunc bool
+	// ctxBefore and ctxAfter are how many context lines are printed before
+	// and after each match group, which patch mode verifies as anchors
+	ctxBefore, ctxAfter int
+	// anchor adds the CRCs of their neighbours to matched lines
+	anchor bool
+	// byLine matches patterns against each line rather than the whole file
+	byLine bool
+	// timeout, when non-zero, limits the time spent searching one file
+	timeout time.Duration
+	summary runSummary
+	// jobs is how many files are searched at once. The files are then
+	// collected into found, like when sorting, and mu guards what parallel
+	// searches share.
+	jobs int
+	mu   sync.Mutex
+	// onError is one of errorPolicies
+	onError    string
+	whySkipped bool
+	trailer    bool
+	// ioLimit, when not nil, throttles reading the files searched
+	ioLimit *rateLimit
+	// mmap maps every file but the smallest into memory, where possible
+	mmap bool
+	// absPaths prints absolute paths, which patch from any directory
+	absPaths bool
+	// quiet prints nothing, and stops at the first match
+	quiet bool
+	// heading prints the path above the records of each file instead of
+	// in each of them
+	heading bool
+	// onlyMatching prints each match alone, with its columns
+	onlyMatching bool
+	// sample, when not nil, keeps some of the matches of each pattern to
+	// print at the end
+	sample *sampler
+	// stdout is where search output goes, which -z wraps in a nulWriter
+	stdout io.Writer
+	// column and byteOffset add where the match is to match records
+	column, byteOffset bool
+	// color highlights matches, paths and line numbers
+	color bool
+	// link, when not nil, makes locations hyperlinks on a terminal
+	link *linker
+	// multiline prints a match across lines as one record, so that it is
+	// replaced as a whole
+	multiline bool
+	// goAST, when not nil, matches Go syntax instead of pats
+	goAST *goPattern
+	// blame, when not nil, annotates matches with who last changed them
+	blame *blamer
+	// rank, when not nil, scores files to print the best first. Files are
+	// then collected into found.
+	rank *ranker
+	// last, when not zero, only prints the last matches of each file
+	last int
+	// maxCount and maxTotal, when not zero, limit the match lines printed
+	// for each file and in all. total counts them, guarded by mu.
+	maxCount, maxTotal, total int
+	// dedup, when not nil, only searches one of each set of identical files
+	dedup *contentDedup
+	// owners, when not nil, notes or counts the CODEOWNERS of matches
+	owners *codeOwners
+	// json prints matches as JSON records, see json.go
+	json bool
+	// changed, when not nil, holds the only lines whose matches are printed
+	changed changedLines
+	// rev, when not nil, reads the files searched from a git revision
+	rev *gitRev
+	// tracked, when not nil, holds the files tracked by git and the
+	// directories above them, the only ones walked with -tracked
+	tracked map[string]bool
+	// baseline, when not nil, holds the matches which are not reported
+	baseline *baseline
+	// rules are the patterns with metadata searched for, which goes into
+	// the JSON records of the lines they match
+	rules []*rule
+	// groups, when not nil, holds the output of each file to print it by
+	// directory at the end. Files are then collected into found.
+	groups *dirGroups
+	// index, when not nil, rules out the files without the trigrams of the
+	// patterns, and indexer, when not nil, indexes files instead of
+	// searching them for gred index
+	index   *trigramIndex
+	indexer *indexBuilder
+	// cache, when not nil, holds the output of this search for each file
+	// as it last was
+	cache *resultCache
+	// collectOnly collects the files walked into found without searching
+	// them, for -watch to look for changes
+	collectOnly bool
 }
 
 func loadSearchConfig(params []string) (*searchConfig, error) {
-	if len(params) == 0 {
+	if len(params) == 0 && patternFlags == nil && *presetFlag == "" && fileFlags == nil && profileRules == nil &&
+		*goASTFlag == "" {
 		return nil, nil
 	}
 	var cfg searchConfig
-	var arg string
-	var i int
-	for i, arg = range params {
+	for _, path := range fileFlags {
+		rules, err := readPatternFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rules {
+			// plain patterns have no metadata to report
+			if r.ID == "" {
+				err = cfg.pushPattern(r.Pattern)
+			} else {
+				err = cfg.pushRule(r)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", path, err)
+			}
+		}
+	}
+	for _, r := range profileRules {
+		if err := cfg.pushRule(r); err != nil {
+			return nil, err
+		}
+	}
+	if *presetFlag != "" {
+		if *fixedFlag {
+			return nil, errors.New("-preset patterns are regexps, so cannot be used with -F")
+		}
+		if err := cfg.pushPreset(*presetFlag); err != nil {
+			return nil, err
+		}
+	}
+	for _, pat := range patternFlags {
+		if err := cfg.pushPattern(pat); err != nil {
+			return nil, err
+		}
+	}
+	// every argument after -- is a pattern, even if it begins with @
+	literal := false
+	for _, arg := range params {
 		switch {
-		case arg == "--":
-			i++
-			break
-		case arg[0] == '@':
+		case literal || !strings.HasPrefix(arg, "@"):
+			if !literal && arg == "--" {
+				literal = true
+				continue
+			}
+			if err := cfg.pushPattern(arg); err != nil {
+				return nil, err
+			}
+		default:
 			arg = arg[1:]
 			finfo, err := os.Stat(arg)
 			if err != nil || finfo.IsDir() {
@@ -52,37 +222,353 @@ func loadSearchConfig(params []string) (*searchConfig, error) {
 			} else {
 				cfg.files = append(cfg.files, arg)
 			}
-		default:
-			if err := cfg.pushPattern(arg); err != nil {
-				return nil, err
-			}
-		}
-	}
-	for ; i < len(params); i++ {
-		if err := cfg.pushPattern(params[i]); err != nil {
-			return nil, err
 		}
 	}
 
-	extglobs, err := parseExtensions(os.Getenv("GREDX"))
+	x, err := parseExtensions(os.Getenv("GREDX"))
 	if err != nil {
 		return nil, err
 	}
-	// extglobs may be nil
-	cfg.globs = append(cfg.globs, extglobs...)
+	// these may all be nil
+	cfg.globs = append(cfg.globs, x.globs...)
+	cfg.excludes = x.excludes
+	cfg.dirs, cfg.skipDirs = x.dirs, x.skipDirs
+	if !*noIgnoreFlag {
+		cfg.ignores = newGitIgnores()
+	}
+	if err := checkSortOrder(*sortFlag); err != nil {
+		return nil, err
+	}
+	cfg.sortBy = *sortFlag
+	if cfg.unordered = *unorderedFlag; cfg.unordered && cfg.sortBy != "" {
+		return nil, errors.New("-unordered cannot be used with -sort")
+	}
+	if isFlagSet("replace") {
+		cfg.replace = []byte(*replaceFlag)
+		cfg.preview = *previewFlag
+		if *lineFlag && len(cfg.pats) > 0 {
+			cfg.replace = append(cfg.replace, "${"+crGroup+"}"...)
+		}
+	} else if *previewFlag {
+		return nil, errors.New("-preview requires -replace")
+	}
+	if *uniqueFlag {
+		cfg.unique = true
+		cfg.uniqSeen = make(map[string]int)
+	}
+	linesOnly := cfg.preview || cfg.unique
+	cfg.passthru = *passthruFlag && !linesOnly
+	cfg.showFunc = *showFuncFlag && !cfg.passthru && !linesOnly
+	// -hunk is -C by another name, and -A and -B override either
+	before, after := *hunkFlag, *hunkFlag
+	if isFlagSet("C") {
+		before, after = *contextFlag, *contextFlag
+	}
+	if isFlagSet("B") {
+		before = *beforeFlag
+	}
+	if isFlagSet("A") {
+		after = *afterFlag
+	}
+	if before < 0 || after < 0 {
+		return nil, errors.New("-hunk, -A, -B and -C must not be negative")
+	}
+	if !cfg.passthru && !linesOnly {
+		cfg.ctxBefore, cfg.ctxAfter = before, after
+	}
+	hasContext := cfg.ctxBefore > 0 || cfg.ctxAfter > 0 || cfg.passthru || cfg.showFunc
+	if *diffOnlyFlag != "" {
+		if hasContext {
+			return nil, errors.New("-diff-only only reports match lines, so cannot be used with context lines")
+		}
+		var err error
+		if cfg.changed, err = gitChangedLines(*diffOnlyFlag, *absPathsFlag); err != nil {
+			return nil, err
+		}
+	}
+	if *trackedFlag {
+		var err error
+		if cfg.tracked, err = gitTrackedFiles(*absPathsFlag); err != nil {
+			return nil, err
+		}
+	}
+	if *baselineFlag != "" {
+		if hasContext {
+			return nil, errors.New("-baseline only reports match lines, so cannot be used with context lines")
+		}
+		var err error
+		if cfg.baseline, err = readBaseline(*baselineFlag, *updateBaselineFlag); err != nil {
+			return nil, err
+		}
+	} else if *updateBaselineFlag {
+		return nil, errors.New("-update-baseline requires -baseline")
+	}
+	cfg.anchor = *anchorFlag && !linesOnly
+	cfg.byLine = *byLineFlag
+	cfg.timeout = *timeoutFlag
+	cfg.whySkipped = *whySkippedFlag
+	cfg.trailer = *trailerFlag
+	cfg.absPaths = *absPathsFlag
+	cfg.onlyMatching = *onlyMatchingFlag
+	cfg.column, cfg.byteOffset = *columnFlag, *byteOffsetFlag
+	cfg.stdout = os.Stdout
+	switch {
+	case searchOutput != nil:
+		cfg.stdout = searchOutput
+	case !isTerminal(os.Stdout):
+		output = newBufferedOutput(os.Stdout)
+		cfg.stdout = output
+	}
+	if nulRecords = *nulFlag; nulRecords {
+		cfg.stdout = nulWriter{cfg.stdout}
+	}
+	if !oneOf(*colorFlag, colorModes) {
+		return nil, fmt.Errorf("-color must be one of: %s", strings.Join(colorModes, ", "))
+	}
+	cfg.color = useColor(*colorFlag)
+	if *hyperlinkFlag && isTerminal(os.Stdout) && os.Getenv("TERM") != "dumb" {
+		cfg.link = newLinker()
+	}
+	if cfg.multiline = *multilineFlag; cfg.multiline && (cfg.byLine || cfg.onlyMatching || linesOnly) {
+		return nil, errors.New("-multiline cannot be used with -by-line, -o, -unique or -preview")
+	}
+	if *goASTFlag != "" {
+		switch {
+		case len(cfg.pats) > 0:
+			return nil, errors.New("-go-ast is the pattern, so cannot be used with other patterns")
+		case cfg.byLine || cfg.onlyMatching || linesOnly || hasContext || *sampleFlag > 0:
+			return nil, errors.New("-go-ast prints whole match lines, so cannot be used with -by-line, -o, " +
+				"-unique, -preview, -sample or context lines")
+		}
+		var err error
+		if cfg.goAST, err = newGoPattern(*goASTFlag, cfg.replace); err != nil {
+			return nil, err
+		}
+	}
+	if *ioLimitFlag != "" {
+		rate, err := parseRate(*ioLimitFlag)
+		if err != nil {
+			return nil, fmt.Errorf("-io-limit: %v", err)
+		}
+		cfg.ioLimit = &rateLimit{rate: rate}
+	}
+	if cfg.mmap = *mmapFlag; cfg.mmap && cfg.ioLimit != nil {
+		return nil, errors.New("-io-limit throttles reads, so cannot be used with -mmap")
+	}
+	cfg.onError = *errorsFlag
+	if !oneOf(cfg.onError, errorPolicies) {
+		return nil, fmt.Errorf("-errors must be one of: %s", strings.Join(errorPolicies, ", "))
+	}
+	cfg.summary.quiet = cfg.onError == "quiet"
+	cfg.summary.all = cfg.whySkipped
+	if cfg.jobs = *jobsFlag; cfg.jobs < 1 {
+		return nil, errors.New("-j must be at least 1")
+	}
+	if *blameFlag {
+		if cfg.unique || cfg.preview {
+			return nil, errors.New("-blame cannot be used with -unique or -preview")
+		}
+		cfg.blame = newBlamer()
+	}
+	if cfg.maxCount, cfg.maxTotal = *maxCountFlag, *maxTotalFlag; cfg.maxCount < 0 || cfg.maxTotal < 0 {
+		return nil, errors.New("-m and -max-total must not be negative")
+	}
+	if cfg.quiet = *quietFlag; cfg.quiet {
+		if *updateBaselineFlag {
+			return nil, errors.New("-q stops at the first match, so cannot be used with -update-baseline")
+		}
+		// one match settles the exit status
+		cfg.maxTotal = 1
+		cfg.stdout = io.Discard
+	}
+	switch {
+	case *firstFlag < 0 || *lastFlag < 0:
+		return nil, errors.New("-first and -last must not be negative")
+	case *firstFlag > 0 && *lastFlag > 0:
+		return nil, errors.New("-first and -last cannot be used together")
+	case *firstFlag > 0 && cfg.maxCount > 0 && *firstFlag != cfg.maxCount:
+		return nil, errors.New("-first is the same as -m, give one")
+	case *firstFlag > 0:
+		cfg.maxCount = *firstFlag
+	case *lastFlag > 0 && (hasContext || linesOnly):
+		return nil, errors.New("-last only prints match lines, so cannot be used with context lines, -unique or -preview")
+	}
+	cfg.last = *lastFlag
+	if *rankFlag {
+		if cfg.sortBy != "" || *collapseFlag > 0 {
+			return nil, errors.New("-rank orders files itself, so cannot be used with -sort or -collapse")
+		}
+		cfg.rank = newRanker()
+	}
+	if *dedupFlag {
+		if *jsonFlag {
+			return nil, errors.New("-dedup-content lists copies in comment lines, so cannot be used with -json")
+		}
+		cfg.dedup = newContentDedup()
+	}
+	switch {
+	case *sampleFlag < 0:
+		return nil, errors.New("-sample must not be negative")
+	case *sampleFlag > 0 && (hasContext || linesOnly || cfg.replace != nil || *jsonFlag || *blameFlag ||
+		*ownersFlag || *collapseFlag > 0):
+		return nil, errors.New("-sample only prints match lines, so cannot be used with context lines, " +
+			"-unique, -preview, -replace, -json, -blame, -owners or -collapse")
+	case *sampleFlag > 0:
+		cfg.sample = newSampler(*sampleFlag, len(cfg.pats))
+	}
+	if *ownersFlag || *groupByFlag != "" {
+		switch {
+		case *groupByFlag != "" && *groupByFlag != "owner":
+			return nil, errors.New("-group-by only accepts owner")
+		case cfg.unique || cfg.preview:
+			return nil, errors.New("-owners and -group-by cannot be used with -unique or -preview")
+		case *groupByFlag != "" && *jsonFlag:
+			return nil, errors.New("-group-by prints comment lines, so cannot be used with -json")
+		}
+		var err error
+		if cfg.owners, err = readCodeOwners(); err != nil {
+			return nil, err
+		}
+		cfg.owners.annotate = *ownersFlag
+		cfg.owners.group = *groupByFlag == "owner"
+	}
+	if cfg.heading = *headingFlag; cfg.heading && *jsonFlag {
+		return nil, errors.New("-heading is a style of text output, so cannot be used with -json")
+	}
+	if cfg.json = *jsonFlag; cfg.json && (cfg.unique || cfg.preview || cfg.trailer || *collapseFlag > 0) {
+		return nil, errors.New("-json cannot be used with -unique, -preview, -trailer or -collapse")
+	}
+	switch {
+	case *collapseFlag < 0:
+		return nil, errors.New("-collapse must not be negative")
+	case *collapseFlag > 0:
+		cfg.groups = newDirGroups(*collapseFlag, expandFlags)
+	case expandFlags != nil:
+		return nil, errors.New("-expand requires -collapse")
+	}
+	if *tuiFlag {
+		if cfg.json || cfg.heading || nulRecords || linesOnly || cfg.quiet || *watchFlag {
+			return nil, errors.New("-tui lists the records of text output, so cannot be used with -json, " +
+				"-heading, -z, -unique, -preview, -q or -watch")
+		}
+		// the records are listed on the terminal, but must be patched
+		cfg.color, cfg.link = false, nil
+	}
+	if *watchFlag && (cfg.unique || cfg.sample != nil || cfg.dedup != nil || cfg.rank != nil || cfg.groups != nil ||
+		cfg.maxTotal > 0 || cfg.trailer) {
+		return nil, errors.New("-watch searches files again as they change, so cannot be used with -unique, " +
+			"-sample, -dedup-content, -rank, -collapse, -max-total, -q or -trailer")
+	}
+	if *revFlag != "" {
+		if cfg.absPaths || cfg.blame != nil || cfg.changed != nil || cfg.tracked != nil || cfg.replace != nil ||
+			cfg.rank != nil || cfg.sortBy == "mtime" || *watchFlag || *tuiFlag {
+			return nil, errors.New("-rev searches files as they were in git, so cannot be used with -abs-paths, " +
+				"-blame, -diff-only, -tracked, -replace, -rank, -sort mtime, -watch or -tui")
+		}
+		var err error
+		if cfg.rev, err = openGitRev(*revFlag); err != nil {
+			return nil, err
+		}
+		if cfg.rev.commits != nil && (cfg.json || len(cfg.pats) == 0) {
+			cfg.rev.close()
+			return nil, errors.New("-rev with a range of commits counts their matches in # comments, " +
+				"so needs patterns and cannot be used with -json")
+		}
+		// the files of a revision are all tracked, so none are ignored
+		cfg.ignores = nil
+	}
+	// -go-ast has no patterns, and copies of files ruled out would still
+	// need listing with -dedup-content
+	if !*noIndexFlag && len(cfg.pats) > 0 && cfg.dedup == nil && cfg.rev == nil {
+		root, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		if idx, err := readIndex(root); err != nil {
+			warn("index: %v, searching every file", err)
+		} else if idx != nil && idx.prepare(cfg.pats) {
+			cfg.index = idx
+		}
+	}
+	if !*noCacheFlag && (len(cfg.pats) > 0 || cfg.goAST != nil) && cfg.cacheable() {
+		var err error
+		if cfg.cache, err = openResultCache(&cfg); err != nil {
+			warn("cache: %v", err)
+		}
+	}
 	if cfg.files == nil && cfg.globs == nil {
 		return nil, nil
 	}
 	return &cfg, nil
 }
 
+// crGroup names the group of -x patterns matching the \r ending a CRLF line.
+const crGroup = "gredCR"
+
 func (cfg *searchConfig) pushPattern(pat string) error {
+	if *fixedFlag {
+		pat = regexp.QuoteMeta(pat)
+	}
+	if *wordFlag {
+		pat = `\b(?:` + pat + `)\b`
+	}
+	if *lineFlag {
+		// $ does not match before the \r of a CRLF line, so it is matched,
+		// and put back by replacements
+		pat = `(?m)^(?:` + pat + `)(?P<` + crGroup + `>\r?)$`
+	}
+	if *ignoreCaseFlag || *smartCaseFlag && !hasUpper(pat) {
+		pat = `(?i)` + pat
+	}
+	if *normFlag {
+		var err error
+		if pat, err = normalizePattern(pat); err != nil {
+			cfg.pats = append(cfg.pats, nil)
+			return err
+		}
+	}
 	re, err := regexp.Compile(pat)
 	// may append nil but that's ok
 	cfg.pats = append(cfg.pats, re)
+	cfg.finders = append(cfg.finders, newFinder(re))
 	return err
 }
 
+// hasUpper reports whether the literal text of pat has an uppercase letter,
+// so classes like \S or \pL do not count. Bad patterns report false and
+// fail to compile later.
+func hasUpper(pat string) bool {
+	re, err := syntax.Parse(pat, syntax.Perl)
+	if err != nil {
+		return false
+	}
+	var upper func(re *syntax.Regexp) bool
+	upper = func(re *syntax.Regexp) bool {
+		if re.Op == syntax.OpLiteral {
+			for _, r := range re.Rune {
+				if unicode.IsUpper(r) {
+					return true
+				}
+			}
+		}
+		for _, sub := range re.Sub {
+			if upper(sub) {
+				return true
+			}
+		}
+		return false
+	}
+	return upper(re)
+}
+
+// replaceLine substitutes the replacement for each pattern's matches in line.
+func (cfg *searchConfig) replaceLine(line []byte) []byte {
+	for _, re := range cfg.pats {
+		line = re.ReplaceAll(line, cfg.replace)
+	}
+	return line
+}
+
 func parseSearchTarget(target string) (paths, globs []string) {
 	for _, trg := range strings.Fields(target) {
 		if _, err := os.Lstat(trg); err == nil {
@@ -94,78 +580,400 @@ func parseSearchTarget(target string) (paths, globs []string) {
 	return
 }
 
-func parseExtensions(dotted string) ([]string, error) {
+// gredx holds the file selection parsed from GREDX.
+type gredx struct {
+	globs, excludes []string
+	dirs, skipDirs  []string
+}
+
+// parseExtensions parses GREDX. Its entries are each preceded by a dot:
+//
+//	.go         search *.go files
+//	.!_test.go  but not *_test.go files
+//	./configs   only search under the configs directory
+//	.!/vendor   never search under the vendor directory
+//
+// Negated and directory entries may themselves contain dots, so they only
+// end where the next one begins. When only those are given, all files are
+// searched.
+func parseExtensions(dotted string) (x gredx, err error) {
 	str := strings.TrimSpace(dotted)
 	switch {
 	case str == "":
-		return nil, nil
+		return
 	case str == ".":
-		return []string{"*"}, nil
+		x.globs = []string{"*"}
+		return
 	case str[0] != '.':
-		return nil, errors.New("invalid GREDX")
+		return x, errors.New("invalid GREDX")
 	}
-	var globs []string
-	for _, ext := range strings.Split(str[1:], ".") {
+	var some bool
+	for _, ext := range splitExtensions(str[1:]) {
 		ext = strings.TrimSpace(ext)
-		if ext == "" {
+		switch {
+		case ext == "":
 			continue
+		case strings.HasPrefix(ext, "!/"):
+			x.skipDirs = append(x.skipDirs, filepath.Clean(ext[2:]))
+		case ext[0] == '/':
+			x.dirs = append(x.dirs, filepath.Clean("."+ext))
+		case ext[0] == '!':
+			x.excludes = append(x.excludes, "*"+ext[1:])
+		default:
+			x.globs = append(x.globs, "*."+ext)
+		}
+		some = true
+	}
+	if some && x.globs == nil {
+		x.globs = []string{"*"}
+	}
+	for _, g := range append(x.globs, x.excludes...) {
+		if _, err := filepath.Match(g, ""); err != nil {
+			return x, fmt.Errorf("invalid GREDX glob %q: %v", g, err)
+		}
+	}
+	return x, nil
+}
+
+// splitExtensions splits the GREDX entries without their leading dots.
+func splitExtensions(str string) []string {
+	var exts []string
+	for str != "" {
+		end := strings.IndexByte(str, '.')
+		if str[0] == '!' || str[0] == '/' {
+			end = -1
+			for _, next := range []string{".!", "./"} {
+				if i := strings.Index(str, next); i >= 0 && (end < 0 || i < end) {
+					end = i
+				}
+			}
+		}
+		if end < 0 {
+			exts = append(exts, str)
+			break
 		}
-		globs = append(globs, "*."+ext)
+		exts = append(exts, str[:end])
+		str = str[end+1:]
 	}
-	return globs, nil
+	return exts
 }
 
 func search(s *searchConfig) error {
 	var err error
-	// s.files may be empty
-	for _, path := range s.files {
-		if err = grep(path, s); err != nil {
-			warn("%s", err)
+	if s.rev != nil && s.rev.commits != nil {
+		err = s.rev.pickaxe(s)
+	} else {
+		err = searchFiles(s)
+	}
+	if s.rev != nil {
+		s.rev.close()
+	}
+	if s.cache != nil {
+		if cacheErr := s.cache.write(); cacheErr != nil {
+			warn("cache: %v", cacheErr)
 		}
 	}
-	if len(s.files) > 0 {
-		return nil
+	if err == nil && s.baseline != nil && s.baseline.update {
+		err = s.baseline.write()
+	}
+	if s.groups != nil {
+		s.groups.print(s.stdout)
+	}
+	if s.dedup != nil {
+		s.dedup.print(s.stdout)
+	}
+	if s.sample != nil {
+		s.sample.print(s.stdout, s)
+	}
+	if s.owners != nil && s.owners.group {
+		s.owners.printTally(s.stdout)
+	}
+	if s.unique {
+		s.printUnique()
+	}
+	if s.trailer {
+		printTrailer(s.stdout, s)
+	}
+	flushOutput()
+	s.summary.report()
+	return err
+}
+
+// searchFiles searches the files named by @ arguments, in the order given
+// or -sort, or else walks the directories of the globs. Output is in the
+// same order with -j, unless -unordered.
+func searchFiles(s *searchConfig) error {
+	var err error
+	if s.sortBy != "" {
+		sortPaths(s.files, s.sortBy)
 	}
-	if s.globs != nil {
-		err = walk(".", s)
+	if s.jobs > 1 || s.groups != nil || s.rank != nil {
+		err = searchParallel(s, s.files)
+	} else {
+		// s.files may be empty
+		for _, path := range s.files {
+			if err = s.fileError(grep(s.stdout, path, s)); err != nil {
+				break
+			}
+		}
+	}
+	if len(s.files) > 0 || err != nil {
+		return err
+	}
+	if s.globs != nil && s.rev != nil {
+		s.found, err = s.rev.files(s)
+	} else if s.globs != nil {
+		roots := s.dirs
+		if roots == nil {
+			roots = []string{"."}
+		}
+		for _, root := range roots {
+			if err = walk(root, s); err != nil {
+				break
+			}
+		}
+		if err == errMaxTotal {
+			err = nil
+		}
+	}
+	if s.sortBy != "" {
+		sortPaths(s.found, s.sortBy)
+	}
+	switch {
+	case err != nil:
+	case s.jobs > 1 || s.groups != nil || s.rank != nil:
+		err = searchParallel(s, s.found)
+	case s.sortBy != "" || s.rev != nil:
+		for _, path := range s.found {
+			if err = s.fileError(grep(s.stdout, path, s)); err != nil {
+				break
+			}
+		}
 	}
 	return err
 }
 
+var errorPolicies = []string{"continue", "abort", "quiet"}
+
+// fileError handles an error with one file or directory according to the
+// -errors policy. It is only returned when the search must stop. Paths
+// which permission is denied to are only noted for the summary, whatever
+// the policy, since whole trees of them are common outside of projects.
+func (cfg *searchConfig) fileError(err error) error {
+	if err == nil {
+		return nil
+	}
+	cfg.summary.failed++
+	var pathErr *fs.PathError
+	if errors.Is(err, fs.ErrPermission) && errors.As(err, &pathErr) {
+		cfg.summary.denied = append(cfg.summary.denied, pathErr.Path)
+		return nil
+	}
+	switch cfg.onError {
+	case "abort":
+		return err
+	case "continue":
+		warn("%s", err)
+	}
+	return nil
+}
+
+// walk searches the files under root. The tree is walked by its extended
+// path so that deep paths work on Windows, but passed on relative to root.
+// The entries of each directory are walked in the byte order of their
+// names, unless -unordered.
 func walk(root string, cfg *searchConfig) error {
-	return filepath.WalkDir(root, cfg.walkFunc)
+	fsRoot := extendedPath(root)
+	walkDir := filepath.WalkDir
+	if cfg.unordered {
+		walkDir = walkUnsorted
+	}
+	return walkDir(fsRoot, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && path == fsRoot {
+			return nil
+		}
+		if fsRoot != root {
+			path = filepath.Join(root, path[len(fsRoot):])
+		}
+		return cfg.walkFunc(path, d, err)
+	})
 }
 
-func (cfg *searchConfig) walkFunc(path string, d fs.DirEntry, err error) error {
+// walkUnsorted is filepath.WalkDir without sorting the entries of each
+// directory, which are walked in the order the file system gives them.
+func walkUnsorted(root string, fn fs.WalkDirFunc) error {
+	info, err := os.Lstat(root)
 	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walkDirUnsorted(root, fs.FileInfoToDirEntry(info), fn)
+	}
+	if err == fs.SkipDir {
+		return nil
+	}
+	return err
+}
+
+func walkDirUnsorted(path string, d fs.DirEntry, fn fs.WalkDirFunc) error {
+	if err := fn(path, d, nil); err != nil || !d.IsDir() {
+		if err == fs.SkipDir && d.IsDir() {
+			err = nil
+		}
 		return err
 	}
+	f, err := os.Open(path)
+	var entries []fs.DirEntry
+	if err == nil {
+		entries, err = f.ReadDir(-1)
+		f.Close()
+	}
+	if err != nil {
+		// as WalkDir, the directory is given again with the error
+		if err = fn(path, d, err); err != nil {
+			if err == fs.SkipDir {
+				err = nil
+			}
+			return err
+		}
+	}
+	for _, e := range entries {
+		if err := walkDirUnsorted(filepath.Join(path, e.Name()), e, fn); err != nil {
+			if err == fs.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (cfg *searchConfig) walkFunc(path string, d fs.DirEntry, err error) error {
+	if err != nil && cfg.collectOnly {
+		// reported by the search already
+		return nil
+	}
+	if err != nil {
+		// unreadable directories are skipped when continuing
+		cfg.skip(path, err.Error())
+		return cfg.fileError(err)
+	}
 	name := d.Name()
 	switch {
-	case path == ".":
+	case d.IsDir() && name[0] == '.':
+		cfg.skip(path, "hidden directory")
+		return fs.SkipDir
+	case d.IsDir() && matchAny(cfg.skipDirs, path):
+		cfg.skip(path, "directory excluded by GREDX")
+		return fs.SkipDir
+	}
+	if from := cfg.ignores.ignored(path, d.IsDir()); from != "" {
+		cfg.skip(path, "ignored by "+from)
+		if d.IsDir() {
+			return fs.SkipDir
+		}
 		return nil
-	case d.IsDir():
-		if name[0] == '.' {
+	}
+	if cfg.tracked != nil && !cfg.tracked[cfg.displayPath(path)] {
+		if d.IsDir() {
+			cfg.skip(path, "no files tracked by git")
 			return fs.SkipDir
 		}
+		cfg.skip(path, "not tracked by git")
+		return nil
+	}
+	switch {
+	case d.IsDir():
+		return nil
+	case matchAny(cfg.excludes, name):
+		cfg.skip(path, "file excluded by GREDX")
 		return nil
 	}
 	for _, g := range cfg.globs {
 		ok, globErr := filepath.Match(g, name)
 		switch {
+		case ok && (cfg.sortBy != "" || cfg.jobs > 1 || cfg.groups != nil || cfg.rank != nil || cfg.collectOnly):
+			cfg.found = append(cfg.found, path)
+			return nil
 		case ok:
-			grep(path, cfg)
+			if err := cfg.fileError(grep(cfg.stdout, path, cfg)); err != nil {
+				return err
+			}
+			if cfg.totalReached() {
+				return errMaxTotal
+			}
 			return nil
 		case globErr != nil:
 			return globErr
 		}
 	}
+	cfg.skip(path, "no glob matched")
+	return nil
+}
+
+// skip records why path was skipped, for -why-skipped.
+func (cfg *searchConfig) skip(path, reason string) {
+	if cfg.whySkipped && !cfg.collectOnly {
+		cfg.summary.skipped = append(cfg.summary.skipped, skipped{path, reason})
+	}
+}
+
+// matchAny reports whether any of globs match name. The globs were
+// checked when parsing GREDX.
+func matchAny(globs []string, name string) bool {
+	for _, g := range globs {
+		if ok, _ := filepath.Match(g, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// find returns the index of the next match of pattern i in buf. When
+// resuming, buf begins with the end of the line last matched.
+func (cfg *searchConfig) find(i int, buf []byte, resume bool) []int {
+	re := cfg.finders[i]
+	if !cfg.byLine {
+		if !resume {
+			return re.FindIndex(buf)
+		}
+		// skip the newline, else empty matches at it would never advance
+		if len(buf) == 0 {
+			return nil
+		}
+		idx := re.FindIndex(buf[1:])
+		if idx != nil {
+			idx[0]++
+			idx[1]++
+		}
+		return idx
+	}
+	off := 0
+	if resume {
+		off = bytes.IndexByte(buf, '\n') + 1
+		if off == 0 {
+			return nil
+		}
+	}
+	for off <= len(buf) {
+		line := buf[off:]
+		end := bytes.IndexByte(line, '\n')
+		if end >= 0 {
+			line = line[:end]
+		}
+		if idx := re.FindIndex(line); idx != nil {
+			return []int{off + idx[0], off + idx[1]}
+		}
+		if end < 0 {
+			break
+		}
+		off += end + 1
+	}
 	return nil
 }
 
 type match struct {
 	fail bool
-	idx [2]int
+	idx  [2]int
 }
 
 func (m *match) store(idx []int) {
@@ -183,28 +991,184 @@ func (m *match) seek(offset int) bool {
 	}
 	m.idx[0] -= offset
 	m.idx[1] -= offset
-	if m.idx[0] < 0 || m.idx[1] < 0 {
-		return true
+	// matches from the newline ending the last line printed are consumed
+	return m.idx[0] <= 0
+}
+
+// displayPath returns path as it is printed, cleaned so that a file has one
+// path however it was named.
+func (s *searchConfig) displayPath(path string) string {
+	if s.rev != nil {
+		return s.rev.label + ":" + filepath.ToSlash(filepath.Clean(path))
 	}
-	return false
+	if s.absPaths {
+		if abs, err := filepath.Abs(path); err == nil {
+			return abs
+		}
+	}
+	return filepath.Clean(path)
 }
 
-func grep(path string, s *searchConfig) error {
-	f, err := os.Open(path)
+// grep searches the file opened by path, printing its output to w, or
+// prints it from the cache when the file has not changed.
+func grep(w io.Writer, path string, s *searchConfig) error {
+	if s.cache != nil {
+		return s.cache.grep(w, path, s)
+	}
+	return grepFile(w, path, s)
+}
+
+func grepFile(w io.Writer, path string, s *searchConfig) error {
+	if s.index != nil && !s.index.mayMatch(path) {
+		s.mu.Lock()
+		s.skip(path, "without the trigrams of the patterns in the index")
+		s.mu.Unlock()
+		return nil
+	}
+	var f *os.File
+	if s.rev == nil {
+		var err error
+		if f, err = os.Open(longPath(path)); err != nil {
+			return err
+		}
+		defer f.Close()
+		if s.indexer != nil {
+			return s.indexer.add(path, f)
+		}
+	}
+	// the path printed, the file is still opened by the path given
+	file := path
+	path = s.displayPath(path)
+	if s.changed != nil && s.changed[filepath.Clean(path)] == nil {
+		return nil
+	}
+	if s.goAST != nil && filepath.Ext(path) != ".go" {
+		return nil
+	}
+	if s.blame != nil {
+		defer s.blame.forget(path)
+	}
+	if s.totalReached() {
+		return nil
+	}
+	var deadline time.Time
+	if s.timeout > 0 {
+		deadline = time.Now().Add(s.timeout)
+	}
+	var win *window
+	var err error
+	release := func() {}
+	if s.rev != nil {
+		var data []byte
+		data, err = s.rev.read(file)
+		win = wholeWindow(data)
+	} else {
+		win, release, err = readFile(f, s)
+	}
+	defer release()
 	if err != nil {
+		// a short read would print and patch a truncated file
 		return err
 	}
-	buf, err := io.ReadAll(f)
+	// data is the window of the file held, buf the part of it yet to be
+	// searched, which begins at off in data
+	data, buf, off := win.data, win.data, 0
+	if s.dedup != nil {
+		s.mu.Lock()
+		dup := s.dedup.dup(path, data)
+		s.mu.Unlock()
+		if dup {
+			return nil
+		}
+	}
+	var tail *tailRecords
+	if s.last > 0 {
+		// the file's matches are printed once they are all found
+		tail = &tailRecords{n: s.last}
+		defer tail.flush(s, w)
+		w = tail
+	}
 	lineno, first := 1, true
-
+	// count is the match lines printed, for -m
+	count := 0
+	// resume is set once buf begins with the newline ending a line searched,
+	// and afterDone once the context after the last match is printed
+	resume, afterDone := false, false
+	var funcRe *regexp.Regexp
+	if s.showFunc {
+		funcRe = funcRegexp(path)
+	}
+	ctxSep := anchorSepLeft
+	if s.passthru {
+		ctxSep = passSepLeft
+	}
+	emit := func(sepLeft rune, lineno int, lines [][]byte) {
+		if len(lines) > 0 {
+			s.printSepLines(w, first, sepLeft, path, lineno, lines)
+			first = false
+		}
+	}
 	ms := make([]match, len(s.pats))
+	// slide moves the window on over a streamed file once buf is searched,
+	// or to read more of the line matched. With gap, nothing in buf matched,
+	// and the lines of a long gap which are not context are left out.
+	slide := func(gap bool) error {
+		if gap {
+			from := 0
+			if !first {
+				from = 1
+			}
+			// the last lines are kept, since a match may begin in them and
+			// go on past the window
+			lines := splitLines(buf[from:])
+			held := overlapLines(lines)
+			after, skip, before := s.splitGap(lines[:len(lines)-held], !first && !afterDone, true)
+			if len(skip) > 0 {
+				emit(ctxSep, lineno+from, after)
+				afterDone = afterDone || !first
+				lineno += len(after) + len(skip)
+				// buf begins at the newline ending the last line skipped,
+				// unless nothing has been printed
+				start := len(data) - bytesLen(before) - bytesLen(lines[len(lines)-held:]) - from
+				buf, off, resume = data[start:], start, !first
+			}
+		}
+		keep := lineAbove(data, off)
+		if err := win.slide(keep); err != nil {
+			return err
+		}
+		data, off = win.data, off-keep
+		buf = data[off:]
+		for i := range s.pats {
+			ms[i] = match{}
+			ms[i].store(s.find(i, buf, resume))
+		}
+		return nil
+	}
+
+	if s.goAST != nil {
+		if err := s.grepGoAST(w, path, data, &first, &count); err != nil {
+			return err
+		}
+		// there are no patterns, nor context lines
+		buf = nil
+	}
+
 	// prime the matches
-	for i, pat := range s.pats {
-		idx := pat.FindIndex(buf)
+	for i := range s.pats {
+		idx := s.find(i, buf, false)
 		ms[i].store(idx)
 	}
 
 	for buf != nil {
+		// patterns cannot be interrupted, so the deadline is only checked
+		// between matches
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			s.mu.Lock()
+			s.summary.timedOut = append(s.summary.timedOut, path)
+			s.mu.Unlock()
+			break
+		}
 		var i, j, min, max int
 		j = -1
 		// TODO: does not handle multiple matches perfectly
@@ -222,27 +1186,100 @@ func grep(path string, s *searchConfig) error {
 				j = i
 			}
 		}
-		if j < 0 {
-			// nothing matched
+		// more of a streamed file is read when nothing matched, or when the
+		// match is on the last line held, as it may go on past it
+		if !win.eof && !s.limitReached(count) &&
+			(j < 0 || ms[j].idx[1]+bytes.IndexByte(buf[ms[j].idx[1]:], '\n') >= len(buf)-1) {
+			if err := slide(j < 0); err != nil {
+				return err
+			}
+			continue
+		}
+		if j < 0 || s.limitReached(count) {
+			// nothing matched, or no more matches are wanted
+			break
+		}
+		if at := ms[j].idx[0]; at == len(buf) && (at == 0 || buf[at-1] == '\n') {
+			// an empty match after the final newline is not on a line
 			break
 		}
 		j, k := lineExpand(ms[j].idx[0], ms[j].idx[1], buf)
 		//fmt.Printf("DBG: j:%d k:%d len:%d buf:%s\n", j, k, len(buf), buf[j:k])
+		if j > 0 {
+			// buf[0] ends the last group unless this is the first
+			from := 0
+			if !first {
+				from = 1
+			}
+			gapno := lineno + from
+			after, skip, before := s.splitGap(splitLines(buf[from:j]), !first && !afterDone, true)
+			emit(ctxSep, gapno, after)
+			if funcRe != nil {
+				end := off + j - bytesLen(before)
+				fline, back := funcContext(funcRe, data[:end], len(skip))
+				if fline != nil {
+					fno := gapno + len(after) + len(skip) - back
+					emit(funcSepLeft, fno, [][]byte{fline})
+				}
+			}
+			emit(ctxSep, gapno+len(after)+len(skip), before)
+		}
 		n, lines := countLines(lineno, buf[:j])
 		lineno += lines
-		n, lines = printLines(first, path, lineno, buf[n:k])
-		if first {
-			first = false
-		}
+		printed, lines, stop := printLines(w, s, &first, &count, path, lineno, buf[n:k], win, off+n)
 		lineno += lines
+		if stop {
+			// keep the newline ending the last line printed, for the context
+			// after it
+			buf, off = buf[n+printed:], off+n+printed
+			if printed == 0 {
+				buf = nil
+			}
+			break
+		}
 		buf = buf[k:]
+		off += k
+		resume, afterDone = true, false
 		for i = 0; i < len(ms); i++ {
-			if i == j || ms[i].seek(k) {
-				idx := s.pats[i].FindIndex(buf)
+			if ms[i].seek(k) {
+				idx := s.find(i, buf, true)
 				ms[i].store(idx)
 			}
 		}
 	}
+	if !first && !afterDone && len(buf) > 0 {
+		// read on for the context after the last match
+		for !win.eof && len(splitLines(buf[1:])) < s.ctxAfter {
+			if err := slide(false); err != nil {
+				return err
+			}
+		}
+		after, _, _ := s.splitGap(splitLines(buf[1:]), true, false)
+		emit(ctxSep, lineno+1, after)
+	}
+	if s.rank != nil {
+		var mtime time.Time
+		if finfo, err := f.Stat(); err == nil {
+			mtime = finfo.ModTime()
+		}
+		// the lines of a streamed file are counted to its end
+		for !win.eof {
+			if err := win.slide(len(win.data)); err != nil {
+				return err
+			}
+		}
+		s.mu.Lock()
+		s.rank.add(path, count, win.lineCount(), mtime)
+		s.mu.Unlock()
+	}
+	if !first {
+		s.mu.Lock()
+		s.summary.matched++
+		if s.dedup != nil {
+			s.dedup.matched[path] = true
+		}
+		s.mu.Unlock()
+	}
 	return nil
 }
 
@@ -258,27 +1295,460 @@ func countLines(lineno int, buf []byte) (n, lines int) {
 	return
 }
 
-func printLines(first bool, path string, lineno int, buf []byte) (n, lines int) {
-	var line []byte
-	for n < len(buf) {
-		if i := bytes.IndexByte(buf[n:], '\n'); i < 0 {
-			line = buf[n:]
-			n += len(buf)
+// printLines prints the matched lines in buf, which begins at offset at
+// of the data of win. buf does not include the newline ending its last
+// line, so a last line of the file without one is printed the same way.
+// first is cleared once a line is printed, and count counts them. Returns
+// the bytes of buf printed and the number of newlines among them. stop is
+// set when -m or -max-total stopped the printing, and then the newline
+// ending the last line printed is not counted.
+func printLines(w io.Writer, s *searchConfig, first *bool, count *int, path string, lineno int, buf []byte, win *window, at int) (n, lines int, stop bool) {
+	if s.multiline && bytes.IndexByte(buf, '\n') >= 0 {
+		// the lines are printed as one span
+		if !s.takeMatch(*count) {
+			return 0, 0, true
+		}
+		if s.printLine(w, *first, path, lineno, buf, win, at) {
+			*first = false
+			*count++
+		} else {
+			s.returnMatch()
+		}
+		return len(buf), bytes.Count(buf, newline), false
+	}
+	// buf holds whole lines, or one empty line when it is empty
+	for {
+		if !s.takeMatch(*count) {
+			if n > 0 {
+				n, lines = n-1, lines-1
+			}
+			return n, lines, true
+		}
+		line := buf[n:]
+		i := bytes.IndexByte(line, '\n')
+		if i >= 0 {
+			line = line[:i]
+		}
+		start := at + n
+		if s.printLine(w, *first, path, lineno+lines, line, win, start) {
+			*first = false
+			*count++
 		} else {
-			line = buf[n:i]
-			n += i + 1
-			lines++
+			s.returnMatch()
 		}
+		if i < 0 {
+			n = len(buf)
+			return
+		}
+		n += i + 1
+		lines++
+	}
+}
+
+// errMaxTotal stops walking once -max-total matches are printed.
+var errMaxTotal = errors.New("max total matches printed")
+
+// limitReached reports whether no more matches may be printed, with count
+// printed in the file already.
+func (s *searchConfig) limitReached(count int) bool {
+	return (s.maxCount > 0 && count >= s.maxCount) || s.totalReached()
+}
+
+func (s *searchConfig) totalReached() bool {
+	if s.maxTotal == 0 {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.total >= s.maxTotal
+}
 
-		sepLeft := crcSepLeft
-		if first {
-			sepLeft = firstSepLeft
+// takeMatch counts a match about to be printed against -max-total, unless
+// no more may be printed. Parallel searches all take from the same total.
+func (s *searchConfig) takeMatch(count int) bool {
+	if s.maxCount > 0 && count >= s.maxCount {
+		return false
+	}
+	if s.maxTotal == 0 {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.total >= s.maxTotal {
+		return false
+	}
+	s.total++
+	return true
+}
+
+// returnMatch gives back a match taken but then left out.
+func (s *searchConfig) returnMatch() {
+	if s.maxTotal > 0 {
+		s.mu.Lock()
+		s.total--
+		s.mu.Unlock()
+	}
+}
+
+// printLine prints one matched line, which begins at offset start of the
+// data of win.
+// With -multiline it may be a span of lines. Returns false when the line is
+// left out for -diff-only or the baseline.
+func (s *searchConfig) printLine(w io.Writer, first bool, path string, lineno int, line []byte, win *window, start int) bool {
+	endLine := 0
+	if s.multiline {
+		if n := bytes.Count(line, newline); n > 0 {
+			endLine = lineno + n
+		}
+	}
+	if !s.admit(path, lineno, endLine, line) {
+		return false
+	}
+	if s.onlyMatching {
+		s.printMatches(w, first, path, lineno, line, win, start)
+		return true
+	}
+	if s.unique {
+		s.countUnique(line)
+		return true
+	}
+	if s.preview {
+		printPreview(w, path, lineno, line, s.replaceLine(line))
+		return true
+	}
+	crc := crcBytes(line)
+	var aboveCRC, belowCRC []byte
+	if s.anchor {
+		above, below := linesAround(win.data, start, start+len(line))
+		aboveCRC, belowCRC = anchorCRC(above), anchorCRC(below)
+	}
+	pos := recordPos{lineno: lineno, endLine: endLine, offset: win.base + start}
+	if s.column {
+		if ms := s.lineMatches(line); len(ms) > 0 {
+			pos.column = ms[0].idx[0] + 1
+		}
+	}
+	if s.replace != nil {
+		line = s.replaceLine(line)
+	}
+	s.printRecord(w, first, crcSepLeft, path, pos, line, crc, aboveCRC, belowCRC)
+	return true
+}
+
+// recordPos is where a record is in its file.
+type recordPos struct {
+	lineno int
+	// endLine is the last line of a -multiline span beginning at lineno,
+	// or 0
+	endLine int
+	// cols are the byte offsets of the part of the line printed with -o,
+	// or nil for all of it
+	cols []int
+	// column is the byte column of the first match, counting from 1, and
+	// offset the byte offset in the file of the line, or of the text with
+	// -o. They are only printed for matches, with -column and -byte-offset.
+	column, offset int
+}
+
+// admit reports whether a match of the lines from lineno to endLine, which
+// may be 0 for just lineno, is to be printed, by -diff-only and -baseline,
+// and counts it for -collapse.
+func (s *searchConfig) admit(path string, lineno, endLine int, line []byte) bool {
+	if s.changed != nil && !s.changed.hasAny(path, lineno, endLine) {
+		return false
+	}
+	if s.baseline != nil {
+		s.mu.Lock()
+		known := s.baseline.suppress(path, crcBytes(line))
+		s.mu.Unlock()
+		if known {
+			return false
+		}
+	}
+	if s.groups != nil {
+		s.mu.Lock()
+		s.groups.counts[path]++
+		s.mu.Unlock()
+	}
+	return true
+}
+
+// printRecord prints one line of search output, as text or with -json.
+// sepLeft says what kind of line it is, the text output uses firstSepLeft
+// instead when first is set. above and below are the CRCs of anchoring
+// neighbour lines, or nil.
+func (s *searchConfig) printRecord(w io.Writer, first bool, sepLeft rune, path string, pos recordPos, line, crc, above, below []byte) {
+	if t, ok := w.(*tailRecords); ok && sepLeft == crcSepLeft {
+		t.add(heldRecord{sepLeft, path, pos, line, crc, above, below})
+		return
+	}
+	var bl *blameLine
+	if s.blame != nil && sepLeft == crcSepLeft {
+		bl = s.blame.line(path, pos.lineno)
+	}
+	var owners []string
+	if s.owners != nil {
+		if sepLeft == crcSepLeft && s.owners.group {
+			s.owners.count(path)
+		}
+		if s.owners.annotate {
+			owners = s.owners.owners(path)
+		}
+	}
+	if s.json {
+		var r *rule
+		var ms []lineMatch
+		if sepLeft == crcSepLeft {
+			r = s.ruleFor(line)
+			if pos.cols == nil && s.replace == nil {
+				ms = s.lineMatches(line)
+			}
+		}
+		printMatchJSON(w, first, sepLeft, path, pos, line, crc, above, below, r, bl, owners, ms, s.jsonPos(sepLeft))
+		return
+	}
+	if first && s.heading && s.sample == nil {
+		// the sampler prints the headings of the records it keeps
+		s.printHeading(w, path)
+	}
+	if first && s.owners != nil && s.owners.annotate {
+		printOwners(w, owners)
+	}
+	isMatch := sepLeft == crcSepLeft
+	if s.sample != nil && isMatch {
+		// the sampler may print it later, and then marks the first lines
+		var rec bytes.Buffer
+		i := s.patternOf(line)
+		defer func() {
+			s.mu.Lock()
+			s.sample.add(i, path, rec.Bytes())
+			s.mu.Unlock()
+		}()
+		w, first = &rec, false
+	}
+	if bl != nil {
+		printBlame(w, bl)
+	}
+	if first {
+		sepLeft = firstSepLeft
+	}
+	if above != nil {
+		crc = append(append(append(append(crc, ':'), above...), ':'), below...)
+	}
+	if s.color && isMatch {
+		switch {
+		case pos.cols != nil:
+			line = []byte(colorMatch + string(line) + colorReset)
+		case s.replace == nil:
+			line = s.highlight(line)
+		}
+	}
+	esc := func(b []byte) []byte { return b }
+	if nulRecords {
+		esc = escapeNul
+		path = string(escapeNul([]byte(path)))
+	}
+	loc := s.location(path, pos, isMatch)
+	if pos.endLine > 0 {
+		// the span may have been replaced by more or fewer lines
+		lines := bytes.Split(line, newline)
+		fmt.Fprintf(w, "%c%s\t%s\t%s\n", seps.of(sepLeft), crc, loc, esc(lines[0]))
+		for _, l := range lines[1:] {
+			fmt.Fprintf(w, "%c\t%s\n", seps.of(spanSepLeft), esc(l))
+		}
+		return
+	}
+	fmt.Fprintf(w, "%c%s\t%s\t%s\n", seps.of(sepLeft), crc, loc, esc(line))
+}
+
+// jsonPos says which positions the JSON record of a line of kind sepLeft
+// has: only match records have them.
+func (s *searchConfig) jsonPos(sepLeft rune) jsonPos {
+	isMatch := sepLeft == crcSepLeft
+	return jsonPos{column: isMatch && s.column, offset: isMatch && s.byteOffset}
+}
+
+// lineMatch is where a pattern matched within a line.
+type lineMatch struct {
+	re  *regexp.Regexp
+	idx []int
+}
+
+// lineMatches returns the non-empty matches of all patterns in line, in
+// order. Where matches overlap the earliest, and then the longest, is kept.
+func (s *searchConfig) lineMatches(line []byte) []lineMatch {
+	var ms []lineMatch
+	for _, re := range s.pats {
+		for _, idx := range re.FindAllSubmatchIndex(line, -1) {
+			if idx[1] > idx[0] {
+				ms = append(ms, lineMatch{re, idx})
+			}
+		}
+	}
+	sort.SliceStable(ms, func(i, j int) bool {
+		if ms[i].idx[0] != ms[j].idx[0] {
+			return ms[i].idx[0] < ms[j].idx[0]
+		}
+		return ms[i].idx[1] > ms[j].idx[1]
+	})
+	kept := ms[:0]
+	end := 0
+	for _, m := range ms {
+		if m.idx[0] >= end {
+			kept = append(kept, m)
+			end = m.idx[1]
+		}
+	}
+	return kept
+}
+
+// printMatches prints each match in the line with -o. The CRC is that of
+// the matched text, which patch mode checks at the same columns.
+func (s *searchConfig) printMatches(w io.Writer, first bool, path string, lineno int, line []byte, win *window, start int) {
+	var aboveCRC, belowCRC []byte
+	if s.anchor {
+		above, below := linesAround(win.data, start, start+len(line))
+		aboveCRC, belowCRC = anchorCRC(above), anchorCRC(below)
+	}
+	for _, m := range s.lineMatches(line) {
+		text := line[m.idx[0]:m.idx[1]]
+		switch {
+		case s.unique:
+			s.countUnique(text)
+			continue
+		case s.preview:
+			printPreview(w, path, lineno, text, m.re.Expand(nil, s.replace, line, m.idx))
+			continue
+		}
+		crc := crcBytes(text)
+		if s.replace != nil {
+			text = m.re.Expand(nil, s.replace, line, m.idx)
+		}
+		pos := recordPos{lineno: lineno, cols: m.idx[:2], column: m.idx[0] + 1, offset: win.base + start + m.idx[0]}
+		s.printRecord(w, first, crcSepLeft, path, pos, text, crc, aboveCRC, belowCRC)
+		first = false
+	}
+}
+
+func (cfg *searchConfig) countUnique(line []byte) {
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	str := string(line)
+	if cfg.uniqSeen[str] == 0 {
+		cfg.uniqs = append(cfg.uniqs, str)
+	}
+	cfg.uniqSeen[str]++
+}
+
+// printUnique prints each distinct matched line once, prefixed by how many
+// times it was matched.
+func (cfg *searchConfig) printUnique() {
+	for _, str := range cfg.uniqs {
+		fmt.Fprintf(cfg.stdout, "%d\t%s\n", cfg.uniqSeen[str], str)
+	}
+}
+
+// printPreview prints the original and replaced line aligned one above the
+// other. Lines left unchanged by the replacement are not printed.
+func printPreview(w io.Writer, path string, lineno int, old, new []byte) {
+	if bytes.Equal(old, new) {
+		return
+	}
+	fmt.Fprintf(w, "%s:%d\t-\t%s\n", path, lineno, old)
+	fmt.Fprintf(w, "%s:%d\t+\t%s\n", path, lineno, new)
+}
+
+// splitGap divides the lines between match groups into the context printed
+// after the previous group, the lines skipped, and the context printed
+// before the next group. prev and next tell if those groups exist.
+func (cfg *searchConfig) splitGap(gap [][]byte, prev, next bool) (after, skip, before [][]byte) {
+	if cfg.passthru {
+		return gap, nil, nil
+	}
+	if prev {
+		k := cfg.ctxAfter
+		if k > len(gap) {
+			k = len(gap)
+		}
+		after, gap = gap[:k], gap[k:]
+	}
+	if next {
+		k := len(gap) - cfg.ctxBefore
+		if k < 0 {
+			k = 0
+		}
+		gap, before = gap[:k], gap[k:]
+	}
+	return after, gap, before
+}
+
+// splitLines splits buf into lines, without their newlines.
+func splitLines(buf []byte) [][]byte {
+	if len(buf) == 0 {
+		return nil
+	}
+	lines := bytes.Split(buf, newline)
+	if len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// bytesLen is the length of lines when each ends with a newline.
+func bytesLen(lines [][]byte) int {
+	n := len(lines)
+	for _, line := range lines {
+		n += len(line)
+	}
+	return n
+}
+
+// printHeading prints the -heading line for the records of path after it.
+func (s *searchConfig) printHeading(w io.Writer, path string) {
+	if nulRecords {
+		path = string(escapeNul([]byte(path)))
+	}
+	text := path
+	if s.color {
+		text = colorPath + path + colorReset
+	}
+	if s.link != nil {
+		text = s.link.link(path, 1, 1, text)
+	}
+	fmt.Fprintf(w, "%c\t%s\n", seps.of(headingSepLeft), text)
+}
+
+// printSepLines prints lines using sepLeft, except that the first line
+// uses firstSepLeft when first is set.
+func (s *searchConfig) printSepLines(w io.Writer, first bool, sepLeft rune, path string, lineno int, lines [][]byte) {
+	for i, line := range lines {
+		s.printRecord(w, first && i == 0, sepLeft, path, recordPos{lineno: lineno + i}, line, crcBytes(line), nil, nil)
+	}
+}
+
+// linesAround returns the lines above and below the line data[i:j], or nil
+// where there are none.
+func linesAround(data []byte, i, j int) (above, below []byte) {
+	if i > 0 {
+		above = data[1+bytes.LastIndexByte(data[:i-1], '\n') : i-1]
+	}
+	if j+1 < len(data) {
+		below = data[j+1:]
+		if k := bytes.IndexByte(below, '\n'); k >= 0 {
+			below = below[:k]
 		}
-		fmt.Printf("%c%s\t%s:%d\t%s\n", sepLeft, crcBytes(line), path, lineno+lines, line)
 	}
 	return
 }
 
+// anchorCRC is the CRC of a neighbouring line, or blank without one.
+func anchorCRC(line []byte) []byte {
+	if line == nil {
+		return []byte("     ")
+	}
+	return crcBytes(line)
+}
+
 func crcBytes(b []byte) []byte {
 	buf := &bytes.Buffer{}
 	crc := crc32.ChecksumIEEE(b)
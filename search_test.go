@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// TestLastLineWithoutNewline checks that the last line of a file without a
+// newline is found, printed, and patched like any other.
+func TestLastLineWithoutNewline(t *testing.T) {
+	var big strings.Builder
+	for i := 0; big.Len() < 256<<10; i++ {
+		fmt.Fprintf(&big, "line %d filler\n", i)
+	}
+	files := map[string]string{
+		"a.txt":   "one\ntwo foo\nthree foo",
+		"b.txt":   "foo",
+		"c.txt":   "x\r\nfoo\r\nlast foo",
+		"big.txt": big.String() + "final foo",
+	}
+	bigLine := strings.Count(files["big.txt"], "\n") + 1
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"foo", "@a.txt", "@b.txt", "@c.txt"},
+			"╓>7Tbt\ta.txt:2\ttwo foo\n║ku<M6\ta.txt:3\tthree foo\n" +
+				"╓N,rPR\tb.txt:1\tfoo\n" +
+				"╓i)]=T\tc.txt:2\tfoo\r\n║SO3XU\tc.txt:3\tlast foo\n"},
+		{[]string{"-x", "three foo", "@a.txt"}, "╓ku<M6\ta.txt:3\tthree foo\n"},
+		{[]string{"-by-line", "foo$", "@a.txt"},
+			"╓>7Tbt\ta.txt:2\ttwo foo\n║ku<M6\ta.txt:3\tthree foo\n"},
+		{[]string{"-B", "1", "three", "@a.txt"},
+			"╓>7Tbt\ta.txt:2\ttwo foo\n║ku<M6\ta.txt:3\tthree foo\n"},
+		{[]string{"-anchor", "three", "@a.txt"}, "╓ku<M6:>7Tbt:     \ta.txt:3\tthree foo\n"},
+		{[]string{"-o", "-byte-offset", "foo", "@a.txt"},
+			"╓N,rPR\ta.txt:2:5-8@8\tfoo\n║N,rPR\ta.txt:3:7-10@18\tfoo\n"},
+		{[]string{"-multiline", `foo\r\nlast`, "@c.txt"}, "╓TK*Bf\tc.txt:2-3\tfoo\r\n┊\tlast foo\n"},
+		{[]string{"final", "@big.txt"}, fmt.Sprintf("╓OZ,-5\tbig.txt:%d\tfinal foo\n", bigLine)},
+		{[]string{"-mmap", "final", "@big.txt"}, fmt.Sprintf("╓OZ,-5\tbig.txt:%d\tfinal foo\n", bigLine)},
+	}
+	dir := writeFiles(t, files)
+	for _, tt := range tests {
+		r := runGred(t, dir, "", nil, tt.args...)
+		if r.code != 0 || r.stdout != tt.want {
+			t.Errorf("gred %s: exit %d, printed\n%q\nwant\n%q\n%s", strings.Join(tt.args, " "), r.code, r.stdout, tt.want, r.stderr)
+		}
+	}
+	if r := runGred(t, dir, "", nil, "verify", "a.txt", "b.txt", "c.txt", "big.txt"); r.code != 0 {
+		t.Errorf("gred verify: exit %d\n%s%s", r.code, r.stdout, r.stderr)
+	}
+
+	out := runGred(t, dir, "", nil, "-replace", "bar", "foo", "@a.txt", "@b.txt", "@c.txt", "@big.txt")
+	if r := runGred(t, dir, out.stdout, nil, "-p"); r.code != 0 {
+		t.Fatalf("gred -p: exit %d\n%s", r.code, r.stderr)
+	}
+	for path, data := range files {
+		if got, want := readTestFile(t, dir, path), strings.ReplaceAll(data, "foo", "bar"); got != want {
+			t.Errorf("%s patched to %q, want %q", path, tail(got), tail(want))
+		}
+	}
+}
+
+// tail returns the end of s, which is all of a short file.
+func tail(s string) string {
+	if len(s) > 40 {
+		return "..." + s[len(s)-40:]
+	}
+	return s
+}
+
+// TestWholeLineCRLF checks that -x matches the lines of CRLF files, and
+// that replacing them keeps their carriage returns.
+func TestWholeLineCRLF(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"c.txt": "x\r\nfoo\r\nlast foo"})
+	r := runGred(t, dir, "", nil, "-x", "foo", "@c.txt")
+	if want := "╓i)]=T\tc.txt:2\tfoo\r\n"; r.code != 0 || r.stdout != want {
+		t.Errorf("gred -x foo: exit %d, printed %q, want %q", r.code, r.stdout, want)
+	}
+	out := runGred(t, dir, "", nil, "-x", "-replace", "b${1}r", "f(o)o", "@c.txt")
+	if r := runGred(t, dir, out.stdout, nil, "-p"); r.code != 0 {
+		t.Fatalf("gred -p: exit %d\n%s", r.code, r.stderr)
+	}
+	if got, want := readTestFile(t, dir, "c.txt"), "x\r\nbor\r\nlast foo"; got != want {
+		t.Errorf("patched to %q, want %q", got, want)
+	}
+}
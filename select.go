@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// openTerminal opens the terminal to prompt on, as standard input may be
+// carrying the patches.
+func openTerminal() (*os.File, error) {
+	name := "/dev/tty"
+	if runtime.GOOS == "windows" {
+		name = "CONIN$"
+	}
+	return os.Open(name)
+}
+
+// selectPatches lists the files patches would change and asks which of them
+// to include. Returns the patches chosen, or nil when the user quits.
+func selectPatches(patches []*patch) ([]*patch, error) {
+	tty, err := openTerminal()
+	if err != nil {
+		return nil, fmt.Errorf("-select needs a terminal: %v", err)
+	}
+	defer tty.Close()
+	return promptSelect(os.Stderr, bufio.NewReader(tty), patches)
+}
+
+func promptSelect(w io.Writer, r *bufio.Reader, patches []*patch) ([]*patch, error) {
+	included := make([]bool, len(patches))
+	for i := range included {
+		included[i] = true
+	}
+	for {
+		for i, p := range patches {
+			mark := ' '
+			if included[i] {
+				mark = 'x'
+			}
+			fmt.Fprintf(w, "[%c] %3d  %s %d\n", mark, i+1, p.path, len(p.lines))
+		}
+		fmt.Fprint(w, "toggle files (e.g. 2 4-6 vendor/*), y to apply, q to quit: ")
+		answer, err := r.ReadString('\n')
+		if err != nil && answer == "" {
+			if err == io.EOF {
+				fmt.Fprintln(w)
+				return nil, nil
+			}
+			return nil, err
+		}
+		switch answer = strings.TrimSpace(answer); answer {
+		case "y":
+			var chosen []*patch
+			for i, p := range patches {
+				if included[i] {
+					chosen = append(chosen, p)
+				}
+			}
+			return chosen, nil
+		case "q":
+			return nil, nil
+		}
+		for _, word := range strings.Fields(answer) {
+			if err := toggleFiles(included, patches, word); err != nil {
+				fmt.Fprintf(w, "%s: %v\n", word, err)
+			}
+		}
+	}
+}
+
+// toggleFiles flips whether the files picked by word are included. word is
+// a list number, a range of them like 4-6, or a glob matched against paths.
+func toggleFiles(included []bool, patches []*patch, word string) error {
+	lo, hi, err := parseRange(word)
+	if err == nil {
+		if lo < 1 || hi > len(patches) || lo > hi {
+			return fmt.Errorf("no such files")
+		}
+		for i := lo - 1; i < hi; i++ {
+			included[i] = !included[i]
+		}
+		return nil
+	}
+	matched := false
+	for i, p := range patches {
+		ok, err := filepath.Match(word, p.path)
+		if err != nil {
+			return err
+		}
+		// dir/* also picks files in subdirectories
+		if ok || strings.HasSuffix(word, "/*") && strings.HasPrefix(p.path, word[:len(word)-1]) {
+			included[i] = !included[i]
+			matched = true
+		}
+	}
+	if !matched {
+		return fmt.Errorf("matches no files")
+	}
+	return nil
+}
+
+func parseRange(word string) (int, int, error) {
+	first, last := word, word
+	if i := strings.IndexByte(word, '-'); i > 0 {
+		first, last = word[:i], word[i+1:]
+	}
+	lo, err := strconv.Atoi(first)
+	if err != nil {
+		return 0, 0, err
+	}
+	hi, err := strconv.Atoi(last)
+	if err != nil {
+		return 0, 0, err
+	}
+	return lo, hi, nil
+}
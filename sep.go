@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// separators are the characters beginning each kind of search output line.
+// The code names the kinds by their box drawing characters, which are
+// printed unless -ascii or GRED_SEP choose others, and patch mode reads
+// any of them.
+type separators struct {
+	first, match, pass, context, function, span, heading, trailer rune
+}
+
+var (
+	boxSeps = separators{firstSepLeft, crcSepLeft, passSepLeft, anchorSepLeft, funcSepLeft,
+		spanSepLeft, headingSepLeft, trailerSepLeft}
+	asciiSeps = separators{'+', '|', ':', '-', '=', '~', '*', '!'}
+	// seps are those printed, inputSeps those patch mode reads
+	seps      = boxSeps
+	inputSeps = []separators{boxSeps, asciiSeps}
+)
+
+// of returns the separator printed for the kind of line named by its box
+// drawing character.
+func (s separators) of(kind rune) rune {
+	switch kind {
+	case firstSepLeft:
+		return s.first
+	case crcSepLeft:
+		return s.match
+	case passSepLeft:
+		return s.pass
+	case anchorSepLeft:
+		return s.context
+	case funcSepLeft:
+		return s.function
+	case spanSepLeft:
+		return s.span
+	case headingSepLeft:
+		return s.heading
+	case trailerSepLeft:
+		return s.trailer
+	}
+	return kind
+}
+
+// setSeparators chooses the separators printed by -ascii or GRED_SEP, which
+// is ascii, box, or the eight separators in the order of separators.
+func setSeparators() error {
+	env := os.Getenv("GRED_SEP")
+	switch {
+	case *asciiFlag || env == "ascii":
+		seps = asciiSeps
+		return nil
+	case env == "" || env == "box":
+		seps = boxSeps
+		return nil
+	}
+	rs := []rune(env)
+	if len(rs) != 8 || !utf8.ValidString(env) {
+		return errors.New("GRED_SEP must be ascii, box, or eight separator characters")
+	}
+	for i, r := range rs {
+		// comments and blank lines are ignored by patch mode
+		if r == '#' || unicode.IsSpace(r) || !unicode.IsPrint(r) {
+			return fmt.Errorf("GRED_SEP: %q cannot be a separator", r)
+		}
+		if strings.ContainsRune(string(rs[:i]), r) {
+			return fmt.Errorf("GRED_SEP: %q is given twice", r)
+		}
+	}
+	seps = separators{rs[0], rs[1], rs[2], rs[3], rs[4], rs[5], rs[6], rs[7]}
+	inputSeps = append(inputSeps[:2], seps)
+	return nil
+}
+
+// cutSep returns the rest of line after the separator of kind, in any of
+// inputSeps, and then after.
+func cutSep(line []byte, kind rune, after string) ([]byte, bool) {
+	r, n := utf8.DecodeRune(line)
+	if n == 0 || !bytes.HasPrefix(line[n:], []byte(after)) {
+		return nil, false
+	}
+	for _, s := range inputSeps {
+		if s.of(kind) == r {
+			return line[n+len(after):], true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// unservedFlags cannot be given in requests: they change what the server
+// does rather than the search or patch, wait on a terminal or for changes,
+// or read or write files other than those searched and patched.
+var unservedFlags = []string{"p", "serve", "root", "select", "tui", "watch", "patch-delay", "abs-paths",
+	"simulate", "tempdir", "in-place", "force-readonly", "follow-symlinks", "f", "baseline", "update-baseline"}
+
+// servedFlags, when not nil, are the flags set for the request being
+// served, which isFlagSet reports instead of those of the command line.
+var servedFlags map[string]bool
+
+// A server runs searches and patches for HTTP requests. The flags are those
+// of the command line for each request, with its own flags set over them,
+// so requests are served one at a time.
+type server struct {
+	mu sync.Mutex
+	// values are the flags of the command line, and set those given
+	values map[string]string
+	set    map[string]bool
+	lists  map[*stringList]stringList
+	gredx  string
+	// token is what HTTP requests must give as Authorization: Bearer
+	token string
+	// protocol is the Model Context Protocol version agreed with the client
+	protocol string
+}
+
+// searchRequest is the body of POST /search. Globs are the @args, and the
+// flags are named without their dash, with lists for those which may be
+// repeated.
+type searchRequest struct {
+	Patterns []string               `json:"patterns"`
+	Globs    []string               `json:"globs"`
+	GREDX    string                 `json:"gredx"`
+	Flags    map[string]interface{} `json:"flags"`
+	// Text answers with the text output, which may be edited and patched,
+	// rather than the -json records
+	Text bool `json:"text"`
+}
+
+// searchResponse counts the files with matches and those which could not
+// be searched, as reported on stderr.
+type searchResponse struct {
+	Records []json.RawMessage `json:"records,omitempty"`
+	Output  *string           `json:"output,omitempty"`
+	Files   int               `json:"files"`
+	Failed  int               `json:"failed"`
+}
+
+type patchResponse struct {
+	Reports []json.RawMessage `json:"reports"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// badRequest is an error in a request, rather than one searching or
+// patching.
+type badRequest struct{ error }
+
+// newServer serves with the flags and GREDX of the command line as the
+// defaults of each request.
+func newServer() *server {
+	sv := &server{
+		values: make(map[string]string),
+		set:    make(map[string]bool),
+		lists: map[*stringList]stringList{
+			&patternFlags: patternFlags,
+			&fileFlags:    fileFlags,
+			&expandFlags:  expandFlags,
+		},
+		gredx: os.Getenv("GREDX"),
+	}
+	flag.VisitAll(func(f *flag.Flag) {
+		if _, ok := f.Value.(*stringList); !ok {
+			sv.values[f.Name] = f.Value.String()
+		}
+	})
+	flag.Visit(func(f *flag.Flag) { sv.set[f.Name] = true })
+	// responses are never for a terminal, and symlinks may lead out of the
+	// directory served, so are not patched through
+	sv.values["color"], sv.values["hyperlink"] = "never", "false"
+	sv.values["follow-symlinks"] = "false"
+	return sv
+}
+
+// serve serves POST /search and POST /patch at addr until it fails. Since
+// they may patch any file below the current directory, addr is on localhost
+// unless it names a host, and requests must give the token of
+// GRED_SERVE_TOKEN, or else the one made up and printed.
+func serve(addr string) {
+	sv := newServer()
+	addr = serveAddr(addr)
+	if sv.token = os.Getenv("GRED_SERVE_TOKEN"); sv.token == "" {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			die("-serve: %v", err)
+		}
+		sv.token = hex.EncodeToString(b)
+		fmt.Fprintf(os.Stderr, "token %s\n", sv.token)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/search", sv.handleSearch)
+	mux.HandleFunc("/patch", sv.handlePatch)
+	hs := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	fmt.Fprintf(os.Stderr, "serving on %s\n", addr)
+	die("%v", hs.ListenAndServe())
+}
+
+// serveAddr returns addr with localhost as its host when it names none, or
+// is only a port.
+func serveAddr(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		host, port = "", addr
+	}
+	if host == "" {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// authorized reports whether r gives the token of the server, answering it
+// when it does not.
+func (sv *server) authorized(w http.ResponseWriter, r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(sv.token)) != 1 {
+		respond(w, http.StatusUnauthorized, errorResponse{"give the token of the server as Authorization: Bearer TOKEN"})
+		return false
+	}
+	return true
+}
+
+// withinRoot reports whether path, of a file or directory to search or
+// patch, is below the directory served, which requests may not leave.
+func withinRoot(path string) bool {
+	if filepath.IsAbs(path) || filepath.VolumeName(path) != "" {
+		return false
+	}
+	path = filepath.Clean(path)
+	return path != ".." && !strings.HasPrefix(path, ".."+string(filepath.Separator))
+}
+
+// reset sets the flags and GREDX back to those of the command line, and
+// then those of the request over them.
+func (sv *server) reset(flags map[string][]string, gredx string) error {
+	for name, value := range sv.values {
+		flag.Set(name, value)
+	}
+	for list, value := range sv.lists {
+		*list = append(stringList(nil), value...)
+	}
+	servedFlags = make(map[string]bool)
+	for name := range sv.set {
+		servedFlags[name] = true
+	}
+	if gredx == "" {
+		gredx = sv.gredx
+	}
+	os.Setenv("GREDX", gredx)
+	for name, values := range flags {
+		if oneOf(name, unservedFlags) {
+			return fmt.Errorf("-%s cannot be given in a request", name)
+		}
+		for _, value := range values {
+			if err := flag.Set(name, value); err != nil {
+				return fmt.Errorf("-%s: %v", name, err)
+			}
+		}
+		servedFlags[name] = true
+	}
+	// -ascii may have changed
+	return setSeparators()
+}
+
+// requestFlags returns the flags of a JSON object by name, with lists for
+// those which may be repeated.
+func requestFlags(obj map[string]interface{}) map[string][]string {
+	flags := make(map[string][]string)
+	for name, v := range obj {
+		if list, ok := v.([]interface{}); ok {
+			for _, item := range list {
+				flags[name] = append(flags[name], fmt.Sprint(item))
+			}
+		} else {
+			flags[name] = []string{fmt.Sprint(v)}
+		}
+	}
+	return flags
+}
+
+func (sv *server) search(req searchRequest) (*searchResponse, error) {
+	flags := requestFlags(req.Flags)
+	if !req.Text {
+		flags["json"] = []string{"true"}
+	}
+	var params []string
+	for _, g := range req.Globs {
+		if !withinRoot(g) {
+			return nil, badRequest{fmt.Errorf("@%s: only files below the directory served may be searched", g)}
+		}
+		params = append(params, "@"+g)
+	}
+	params = append(append(params, "--"), req.Patterns...)
+
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	var out bytes.Buffer
+	searchOutput = &out
+	defer func() { searchOutput = nil }()
+	if err := sv.reset(flags, req.GREDX); err != nil {
+		return nil, badRequest{err}
+	}
+	s, err := loadSearchConfig(params)
+	switch {
+	case err != nil:
+		return nil, badRequest{err}
+	case s == nil:
+		return nil, badRequest{errors.New("no files to search, give globs or gredx")}
+	}
+	if err := search(s); err != nil {
+		return nil, err
+	}
+	resp := &searchResponse{Files: s.summary.matched, Failed: s.summary.failed}
+	if req.Text {
+		text := out.String()
+		resp.Output = &text
+	} else {
+		resp.Records = jsonLines(out.Bytes())
+	}
+	return resp, nil
+}
+
+// patch applies the patch input with the flags.
+func (sv *server) patch(flags map[string][]string, input io.Reader) (*patchResponse, error) {
+	flags["json"], flags["progress"] = []string{"true"}, []string{"0"}
+
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	err := sv.reset(flags, "")
+	if err == nil {
+		err = checkPatchFlags()
+	}
+	if err != nil {
+		return nil, badRequest{err}
+	}
+	all, err := readPatches(input)
+	if err != nil {
+		return nil, badRequest{err}
+	}
+	for _, p := range all {
+		if !withinRoot(p.path) {
+			return nil, badRequest{fmt.Errorf("%s: only files below the directory served may be patched", p.path)}
+		}
+	}
+	patches, err := editPatches(nil, make(map[string]*patch), all, "request")
+	if err != nil {
+		return nil, badRequest{err}
+	}
+	var out bytes.Buffer
+	patchMode(&out, patches)
+	return &patchResponse{jsonLines(out.Bytes())}, nil
+}
+
+func (sv *server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	if !sv.authorized(w, r) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		respond(w, http.StatusMethodNotAllowed, errorResponse{"POST a search"})
+		return
+	}
+	var req searchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respond(w, http.StatusBadRequest, errorResponse{err.Error()})
+		return
+	}
+	resp, err := sv.search(req)
+	respondTo(w, resp, err)
+}
+
+// handlePatch applies the patch input of the request body, with the flags
+// of its query.
+func (sv *server) handlePatch(w http.ResponseWriter, r *http.Request) {
+	if !sv.authorized(w, r) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		respond(w, http.StatusMethodNotAllowed, errorResponse{"POST patch input"})
+		return
+	}
+	resp, err := sv.patch(map[string][]string(r.URL.Query()), r.Body)
+	respondTo(w, resp, err)
+}
+
+// jsonLines splits the lines of -json output into their records.
+func jsonLines(out []byte) []json.RawMessage {
+	recs := []json.RawMessage{}
+	for _, line := range bytes.Split(out, newline) {
+		if len(line) > 0 {
+			recs = append(recs, line)
+		}
+	}
+	return recs
+}
+
+// respondTo answers with resp, or the error in its place.
+func respondTo(w http.ResponseWriter, resp interface{}, err error) {
+	var bad badRequest
+	switch {
+	case errors.As(err, &bad):
+		respond(w, http.StatusBadRequest, errorResponse{err.Error()})
+	case err != nil:
+		respond(w, http.StatusInternalServerError, errorResponse{err.Error()})
+	default:
+		respond(w, http.StatusOK, resp)
+	}
+}
+
+func respond(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	printJSON(w, v)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestServeRefuses checks that requests without the token, with flags
+// writing elsewhere, or for files outside the directory served are refused.
+func TestServeRefuses(t *testing.T) {
+	sv := newServer()
+	sv.token = "secret"
+	tests := []struct {
+		name, path, token, body string
+		status                  int
+	}{
+		{"no token", "/search", "", `{"patterns": ["x"], "globs": ["gred.go"]}`, http.StatusUnauthorized},
+		{"wrong token", "/search", "secreT", `{"patterns": ["x"], "globs": ["gred.go"]}`, http.StatusUnauthorized},
+		{"simulate", "/search", "secret", `{"patterns": ["x"], "globs": ["gred.go"], "flags": {"simulate": "/tmp/x"}}`, http.StatusBadRequest},
+		{"pattern file", "/search", "secret", `{"globs": ["gred.go"], "flags": {"f": "/etc/passwd"}}`, http.StatusBadRequest},
+		{"absolute glob", "/search", "secret", `{"patterns": ["root"], "globs": ["/etc/passwd"]}`, http.StatusBadRequest},
+		{"parent glob", "/search", "secret", `{"patterns": ["x"], "globs": ["../x"]}`, http.StatusBadRequest},
+		{"absolute patch", "/patch", "secret", "╓>7Tbt\t/etc/hosts:2\tx\n", http.StatusBadRequest},
+		{"parent patch", "/patch", "secret", "╓>7Tbt\t../x/r.txt:2\tx\n", http.StatusBadRequest},
+		{"in-place patch", "/patch?in-place=true", "secret", "╓>7Tbt\tr.txt:2\tx\n", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+		if tt.token != "" {
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		w := httptest.NewRecorder()
+		if strings.HasPrefix(tt.path, "/search") {
+			sv.handleSearch(w, r)
+		} else {
+			sv.handlePatch(w, r)
+		}
+		if w.Code != tt.status {
+			t.Errorf("%s: status %d, want %d\n%s", tt.name, w.Code, tt.status, w.Body)
+		}
+	}
+}
+
+func TestServeAddr(t *testing.T) {
+	for addr, want := range map[string]string{
+		":8080":          "localhost:8080",
+		"8080":           "localhost:8080",
+		"0.0.0.0:8080":   "0.0.0.0:8080",
+		"localhost:8080": "localhost:8080",
+		"[::1]:8080":     "[::1]:8080",
+	} {
+		if got := serveAddr(addr); got != want {
+			t.Errorf("serveAddr(%q) = %q, want %q", addr, got, want)
+		}
+	}
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A session is search output saved by gred save to be picked up again
+// later with gred load. It is kept as the output itself, so it may also be
+// edited and patched directly, with comments giving the directory it was
+// searched in and the freshness of each file when saved:
+//
+//	# gred session todos
+//	#root	/home/me/src/proj
+//	#fresh	1234	2026-10-14T09:06:16.123456789Z	main.go
+//	║...	main.go:12	// TODO: ...
+const (
+	sessionRootPrefix  = "#root\t"
+	sessionFreshPrefix = "#fresh\t"
+	// stalePrefix comments out the records gred load finds stale, so that
+	// patch mode leaves them out
+	stalePrefix = "# stale: "
+)
+
+// sessionDir is $GRED_SESSIONS, or else gred/sessions in the user's config
+// directory.
+func sessionDir() (string, error) {
+	if dir := os.Getenv("GRED_SESSIONS"); dir != "" {
+		return dir, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gred", "sessions"), nil
+}
+
+// sessionPath returns the file of the named session, or lists the sessions
+// and exits when there is no name.
+func sessionPath(cmd string, args []string) string {
+	dir, err := sessionDir()
+	if err != nil {
+		die("%v", err)
+	}
+	if len(args) == 0 {
+		entries, err := os.ReadDir(dir)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			die("%v", err)
+		}
+		for _, e := range entries {
+			if !e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+				fmt.Println(e.Name())
+			}
+		}
+		os.Exit(0)
+	}
+	name := args[0]
+	if name == "" || name[0] == '.' || strings.ContainsAny(name, `/\`) {
+		die("%s: bad session name %q", cmd, name)
+	}
+	return filepath.Join(dir, name)
+}
+
+// freshness is what tells whether a file changed since it was searched.
+type freshness struct {
+	size  int64
+	mtime time.Time
+}
+
+func (f freshness) same(g freshness) bool {
+	return f.size == g.size && f.mtime.Equal(g.mtime)
+}
+
+func statFreshness(path string) (freshness, error) {
+	finfo, err := os.Stat(longPath(path))
+	if err != nil {
+		return freshness{}, err
+	}
+	return freshness{finfo.Size(), finfo.ModTime()}, nil
+}
+
+// saveMode saves the search output read from the files after the session
+// name, or stdin, as the named session, replacing any saved before.
+func saveMode(args []string) {
+	if *nulFlag {
+		die("save: -z output cannot be saved, sessions are lines")
+	}
+	path := sessionPath("save", args)
+	var in []io.Reader
+	for _, name := range args[1:] {
+		f, err := os.Open(name)
+		if err != nil {
+			die("%v", err)
+		}
+		defer f.Close()
+		in = append(in, f)
+	}
+	if len(in) == 0 {
+		in = append(in, os.Stdin)
+	}
+	root, err := os.Getwd()
+	if err != nil {
+		die("%v", err)
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# gred session %s\n%s%s\n", args[0], sessionRootPrefix, root)
+	files, records := 0, 0
+	seen := make(map[string]bool)
+	for _, r := range in {
+		scan := newLineScanner(r)
+		for scan.Scan() {
+			line := scan.Bytes()
+			_, heading := cutSep(line, headingSepLeft, "\t")
+			_, span := cutSep(line, spanSepLeft, "\t")
+			switch {
+			case heading, bytes.HasPrefix(line, []byte(sessionRootPrefix)),
+				bytes.HasPrefix(line, []byte(sessionFreshPrefix)):
+				// heading paths are put back in their records, and a
+				// session saved again is freshened
+				continue
+			case ignoredPatchLine(line), span:
+				b.Write(line)
+				b.WriteByte('\n')
+				continue
+			}
+			m := patchPrefixRe.FindSubmatch(line)
+			if m == nil {
+				die("save: line %d: %v", scan.n, BadPatchPrefix)
+			}
+			if p := recordPath(m); !seen[p] {
+				seen[p] = true
+				fresh, err := statFreshness(p)
+				if err != nil {
+					die("save: %v", err)
+				}
+				fmt.Fprintf(&b, "%s%d\t%s\t%s\n", sessionFreshPrefix, fresh.size, fresh.mtime.UTC().Format(time.RFC3339Nano), p)
+				files++
+			}
+			b.Write(line)
+			b.WriteByte('\n')
+			records++
+		}
+		if err := scan.Err(); err != nil {
+			die("save: %v", err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		die("%v", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b.Bytes(), 0o600); err != nil {
+		die("%v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		die("%v", err)
+	}
+	fmt.Fprintf(os.Stderr, "saved %d records of %d files as %s\n", records, files, args[0])
+}
+
+// sessionRecord is a record of a loaded session with its span lines, or a
+// comment when ln is nil.
+type sessionRecord struct {
+	lines [][]byte
+	path  string
+	ln    *patchLine
+	// nums are the offsets of the line number in the record, and of the
+	// last line of a span or -1, from the prefixLine and prefixEndLine
+	// submatches
+	nums []int
+}
+
+// move renumbers the record for its line being found at index i.
+func (rec *sessionRecord) move(i int) {
+	line := rec.lines[0]
+	delta := i + 1 - rec.ln.n
+	var b []byte
+	b = append(b, line[:rec.nums[0]]...)
+	b = strconv.AppendInt(b, int64(i+1), 10)
+	if rec.nums[2] >= 0 {
+		end, _ := strconv.Atoi(string(line[rec.nums[2]:rec.nums[3]]))
+		b = append(b, '-')
+		b = strconv.AppendInt(b, int64(end+delta), 10)
+		b = append(b, line[rec.nums[3]:]...)
+	} else {
+		b = append(b, line[rec.nums[1]:]...)
+	}
+	rec.lines[0] = b
+}
+
+// loadMode prints the named session, re-validating the records of each
+// file which changed since it was saved. Records whose lines moved are
+// renumbered, as -relocate global would find them, and those whose lines
+// are gone are commented out as stale. The records of unchanged files are
+// printed as they are.
+func loadMode(args []string) {
+	if len(args) > 1 {
+		warn("load accepts only the session name")
+		usage()
+	}
+	path := sessionPath("load", args)
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		die("load: no session named %s", args[0])
+	} else if err != nil {
+		die("%v", err)
+	}
+	defer f.Close()
+	var root string
+	saved := make(map[string]freshness)
+	var recs []*sessionRecord
+	scan := newLineScanner(f)
+	for scan.Scan() {
+		line := append([]byte(nil), scan.Bytes()...)
+		spanLine, span := cutSep(line, spanSepLeft, "\t")
+		switch {
+		case bytes.HasPrefix(line, []byte(sessionRootPrefix)):
+			root = string(line[len(sessionRootPrefix):])
+		case bytes.HasPrefix(line, []byte(sessionFreshPrefix)):
+			fields := strings.SplitN(string(line[len(sessionFreshPrefix):]), "\t", 3)
+			if len(fields) != 3 {
+				die("load: line %d: bad freshness", scan.n)
+			}
+			size, err := strconv.ParseInt(fields[0], 10, 64)
+			if err != nil {
+				die("load: line %d: %v", scan.n, err)
+			}
+			mtime, err := time.Parse(time.RFC3339Nano, fields[1])
+			if err != nil {
+				die("load: line %d: %v", scan.n, err)
+			}
+			saved[filepath.Clean(fields[2])] = freshness{size, mtime}
+		case span && len(recs) > 0 && recs[len(recs)-1].ln != nil:
+			rec := recs[len(recs)-1]
+			rec.lines = append(rec.lines, line)
+			if err := rec.ln.continueSpan(spanLine); err != nil {
+				die("load: line %d: %v", scan.n, err)
+			}
+			continue
+		case ignoredPatchLine(line):
+		default:
+			idx := patchPrefixRe.FindSubmatchIndex(line)
+			if idx == nil {
+				die("load: line %d: %v", scan.n, BadPatchPrefix)
+			}
+			m := make([][]byte, len(idx)/2)
+			for i := range m {
+				if idx[2*i] >= 0 {
+					m[i] = line[idx[2*i]:idx[2*i+1]]
+				}
+			}
+			ln, err := newPatchLine(m, line[idx[1]:], scan.n)
+			if err != nil {
+				die("load: line %d: %v", scan.n, err)
+			}
+			recs = append(recs, &sessionRecord{[][]byte{line}, recordPath(m), ln, idx[2*prefixLine : 2*prefixEndLine+2]})
+			continue
+		}
+		recs = append(recs, &sessionRecord{lines: [][]byte{line}})
+	}
+	if err := scan.Err(); err != nil {
+		die("load: %v", err)
+	}
+	if root != "" {
+		if err := os.Chdir(root); err != nil {
+			die("%v", err)
+		}
+		if startDir != root {
+			warn("the paths of session %s are relative to %s", args[0], root)
+		}
+	}
+
+	// unchanged says which files are as saved, and targets holds the others,
+	// each read once, or nil when gone
+	unchanged := make(map[string]bool)
+	targets := make(map[string]*target)
+	stale := make(map[string]int)
+	out := bufio.NewWriter(os.Stdout)
+	total, moved := 0, 0
+	for _, rec := range recs {
+		if rec.ln == nil {
+			out.Write(rec.lines[0])
+			out.WriteByte('\n')
+			continue
+		}
+		total++
+		same, checked := unchanged[rec.path]
+		if !checked {
+			fresh, err := statFreshness(rec.path)
+			same = err == nil && saved[rec.path].same(fresh)
+			unchanged[rec.path] = same
+			if !same {
+				// lines which moved are found anywhere they are unique,
+				// and renumbered
+				targets[rec.path] = readSessionTarget(rec.path)
+			}
+		}
+		prefix := ""
+		if !same {
+			t := targets[rec.path]
+			if t == nil {
+				prefix = stalePrefix
+			} else if i, err := t.locate(rec.ln); err != nil {
+				prefix = stalePrefix
+			} else if i != rec.ln.n-1 {
+				rec.move(i)
+				moved++
+			}
+		}
+		if prefix != "" {
+			stale[rec.path]++
+		}
+		for _, line := range rec.lines {
+			out.WriteString(prefix)
+			out.Write(line)
+			out.WriteByte('\n')
+		}
+	}
+	if err := out.Flush(); err != nil {
+		die("%v", err)
+	}
+	n := 0
+	paths := make([]string, 0, len(stale))
+	for path, k := range stale {
+		n += k
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		fmt.Fprintf(os.Stderr, "%s: %d stale\n", path, stale[path])
+	}
+	fmt.Fprintf(os.Stderr, "%d of %d records stale, %d moved, %d files changed\n", n, total, moved, len(targets))
+}
+
+// readSessionTarget reads a file which changed since it was saved, or
+// returns nil when it cannot be read, leaving all its records stale.
+func readSessionTarget(path string) *target {
+	f, err := os.Open(longPath(path))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	t, err := readTarget(f)
+	if err != nil {
+		return nil
+	}
+	t.relocate = "global"
+	return t
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestSessionRoundTrip checks that gred load renumbers the records of a
+// session which moved since it was saved, and comments out the stale ones.
+func TestSessionRoundTrip(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"a.txt": "one foo\ntwo\n", "b.txt": "x foo\n"})
+	env := []string{"GRED_SESSIONS=" + t.TempDir()}
+	out := runGred(t, dir, "", env, "foo", "@a.txt", "@b.txt")
+	if r := runGred(t, dir, out.stdout, env, "save", "todos"); r.code != 0 {
+		t.Fatalf("save: exit %d\n%s", r.code, r.stderr)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("new\none foo\ntwo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "b.txt"), []byte("x fob\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r := runGred(t, dir, "", env, "load", "todos")
+	if r.code != 0 {
+		t.Fatalf("load: exit %d\n%s", r.code, r.stderr)
+	}
+	for _, want := range []string{"╓:qgOT\ta.txt:2\tone foo\n", stalePrefix + "╓gji0A\tb.txt:1\tx foo\n"} {
+		if !strings.Contains(r.stdout, want) {
+			t.Errorf("load printed\n%s\nwithout %q", r.stdout, want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+var sortOrders = []string{"path", "mtime"}
+
+func checkSortOrder(by string) error {
+	if by == "" || oneOf(by, sortOrders) {
+		return nil
+	}
+	return fmt.Errorf("unknown sort order %q", by)
+}
+
+// sortPaths sorts paths in place by the given order. Modification times
+// sort newest first, files which cannot be stat'ed sort last.
+func sortPaths(paths []string, by string) {
+	switch by {
+	case "path":
+		sort.SliceStable(paths, func(i, j int) bool {
+			return pathLess(paths[i], paths[j])
+		})
+	case "mtime":
+		mtimes := make(map[string]time.Time, len(paths))
+		for _, path := range paths {
+			if finfo, err := os.Stat(path); err == nil {
+				mtimes[path] = finfo.ModTime()
+			}
+		}
+		sort.SliceStable(paths, func(i, j int) bool {
+			ti, tj := mtimes[paths[i]], mtimes[paths[j]]
+			if ti.Equal(tj) {
+				return paths[i] < paths[j]
+			}
+			return ti.After(tj)
+		})
+	}
+}
+
+// pathLess orders paths by directory and then file name, so the files of
+// one directory are kept together ahead of its subdirectories. Both are
+// compared with naturalLess.
+func pathLess(a, b string) bool {
+	adir, afile := filepath.Split(a)
+	bdir, bfile := filepath.Split(b)
+	if adir != bdir {
+		return naturalLess(adir, bdir)
+	}
+	return naturalLess(afile, bfile)
+}
+
+// naturalLess compares runs of digits by their numeric value, so that
+// "file2" sorts before "file10". Other bytes compare as usual.
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		i, j := digitsLen(a), digitsLen(b)
+		if i == 0 || j == 0 {
+			if a[0] != b[0] {
+				return a[0] < b[0]
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+		an, bn := trimZeros(a[:i]), trimZeros(b[:j])
+		switch {
+		case len(an) != len(bn):
+			return len(an) < len(bn)
+		case an != bn:
+			return an < bn
+		case i != j:
+			// fewer leading zeros first
+			return i < j
+		}
+		a, b = a[i:], b[j:]
+	}
+	return len(a) < len(b)
+}
+
+func digitsLen(s string) int {
+	var i int
+	for i < len(s) && '0' <= s[i] && s[i] <= '9' {
+		i++
+	}
+	return i
+}
+
+func trimZeros(digits string) string {
+	for len(digits) > 1 && digits[0] == '0' {
+		digits = digits[1:]
+	}
+	return digits
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+)
+
+// streamBlock is about how much more of a streamed file is read at a time,
+// and streamOverlap how much of what was read is kept when it moves on.
+const (
+	streamBlock   = 1 << 20
+	streamOverlap = 64 << 10
+)
+
+// window holds the part of a file being searched in data, which begins at
+// the byte offset base of the file. Files read whole have it all in data,
+// while large files and those which are not regular files are streamed
+// through it, so that memory use is bounded by the length of their lines
+// rather than their size. Streamed lines may be at most maxPatchLine bytes,
+// and a match going on past the window must begin on its last line or in
+// the last streamOverlap bytes.
+type window struct {
+	r    io.Reader
+	name string
+	// data is the whole lines of buf, or all of it at eof
+	data, buf []byte
+	base      int
+	// lines counts the newlines of the file before data
+	lines int
+	eof   bool
+}
+
+func wholeWindow(data []byte) *window {
+	return &window{data: data, buf: data, eof: true}
+}
+
+// newStreamWindow streams the file named name from r.
+func newStreamWindow(r io.Reader, name string) (*window, error) {
+	win := &window{r: r, name: name}
+	return win, win.slide(0)
+}
+
+// slide drops the first n bytes of data and reads on until at least a
+// block more and one more line are held, or the file ends. Pipes are read
+// only as far as the lines written to them so far, once there is one.
+func (win *window) slide(n int) error {
+	if win.eof {
+		return nil
+	}
+	win.lines += bytes.Count(win.data[:n], newline)
+	win.base += n
+	win.buf = win.buf[:copy(win.buf, win.buf[n:])]
+	// the line after data begins at end
+	end := len(win.data) - n
+	want := len(win.buf) + streamBlock
+	newLine, short := false, false
+	for !win.eof && (!newLine || (len(win.buf) < want && !short)) {
+		if len(win.buf) == cap(win.buf) {
+			buf := make([]byte, len(win.buf), 2*cap(win.buf)+streamBlock)
+			copy(buf, win.buf)
+			win.buf = buf
+		}
+		m, err := win.r.Read(win.buf[len(win.buf):cap(win.buf)])
+		short = m < cap(win.buf)-len(win.buf)
+		if bytes.IndexByte(win.buf[len(win.buf):len(win.buf)+m], '\n') >= 0 {
+			newLine = true
+		}
+		win.buf = win.buf[:len(win.buf)+m]
+		switch {
+		case err == io.EOF:
+			win.eof = true
+		case err != nil:
+			return err
+		case !newLine && len(win.buf)-end > maxPatchLine:
+			// named like the errors of reading the file
+			return &fs.PathError{Op: "read", Path: win.name, Err: fmt.Errorf(
+				"line %d is longer than %d bytes, use -max-line to raise it",
+				win.lines+bytes.Count(win.buf[:end], newline)+1, maxPatchLine)}
+		}
+	}
+	win.data = win.buf
+	if !win.eof {
+		win.data = win.buf[:1+bytes.LastIndexByte(win.buf, '\n')]
+	}
+	return nil
+}
+
+// lineCount is the number of lines of the file once it has all been read.
+func (win *window) lineCount() int {
+	return win.lines + bytes.Count(win.data, newline) + 1
+}
+
+// streams reports whether files may be searched through a window rather
+// than read whole. Some searches need all of a file at once: -go-ast parses
+// it, -dedup-content compares it, -show-function looks back any distance
+// for the function, -multiline matches may be any length, and -passthru
+// holds the lines before the first match until a match is known.
+func (s *searchConfig) streams() bool {
+	return s.goAST == nil && s.dedup == nil && !s.showFunc && !s.multiline && !s.passthru
+}
+
+// overlapLines returns how many of the last lines must be kept to keep the
+// last line and streamOverlap bytes.
+func overlapLines(lines [][]byte) int {
+	n := 0
+	for i := len(lines) - 1; i >= 0; i-- {
+		n += len(lines[i]) + 1
+		if n >= streamOverlap {
+			return len(lines) - i
+		}
+	}
+	return len(lines)
+}
+
+// lineAbove returns the offset in data of the line above the one beginning
+// at i, or ending at i with its newline. Data kept from there keeps the
+// line above a match for -anchor.
+func lineAbove(data []byte, i int) int {
+	if i == 0 {
+		return 0
+	}
+	return 1 + bytes.LastIndexByte(data[:i-1], '\n')
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// runSummary collects what happened to files during a search, to be
+// reported once it ends.
+type runSummary struct {
+	// matched counts the files with matches
+	matched int
+	// timedOut files have only had their earlier matches printed
+	timedOut []string
+	// skipped is only kept for -why-skipped
+	skipped []skipped
+	// failed counts the files and directories which could not be read,
+	// including those denied
+	failed int
+	denied []string
+	quiet  bool
+	// all lists every path denied rather than their directories
+	all bool
+}
+
+// maxDeniedDirs is how many directories with paths denied are reported.
+const maxDeniedDirs = 10
+
+type skipped struct {
+	path, reason string
+}
+
+func (r *runSummary) report() {
+	for _, sk := range r.skipped {
+		fmt.Fprintf(os.Stderr, "skipped %s: %s\n", sk.path, sk.reason)
+	}
+	if len(r.timedOut) > 0 {
+		warn("search timed out in %d file(s), later matches were skipped: %s",
+			len(r.timedOut), strings.Join(r.timedOut, ", "))
+	}
+	if r.quiet {
+		return
+	}
+	if len(r.denied) > 0 {
+		r.reportDenied()
+	}
+	if n := r.failed - len(r.denied); n > 0 {
+		warn("%d path(s) could not be searched", n)
+	}
+}
+
+// reportDenied lists the directories with paths which permission was
+// denied to, most first, or with -why-skipped the paths themselves.
+func (r *runSummary) reportDenied() {
+	warn("permission denied to %d path(s)", len(r.denied))
+	if r.all {
+		sort.Strings(r.denied)
+		for _, path := range r.denied {
+			fmt.Fprintf(os.Stderr, "denied %s\n", path)
+		}
+		return
+	}
+	counts := make(map[string]int)
+	for _, path := range r.denied {
+		counts[filepath.Dir(path)]++
+	}
+	dirs := make([]string, 0, len(counts))
+	for dir := range counts {
+		dirs = append(dirs, dir)
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		if counts[dirs[i]] != counts[dirs[j]] {
+			return counts[dirs[i]] > counts[dirs[j]]
+		}
+		return dirs[i] < dirs[j]
+	})
+	for i, dir := range dirs {
+		if i == maxDeniedDirs {
+			fmt.Fprintf(os.Stderr, "denied in %d more directories, -why-skipped lists them all\n", len(dirs)-i)
+			break
+		}
+		fmt.Fprintf(os.Stderr, "denied %d in %s\n", counts[dir], dir)
+	}
+}
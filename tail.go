@@ -0,0 +1,41 @@
+package main
+
+import "io"
+
+// tailRecords keeps the last n match records of a file for -last, to be
+// printed once the file has been searched. Only match records are kept,
+// as -last refuses the options printing other lines.
+type tailRecords struct {
+	n    int
+	recs []heldRecord
+}
+
+// heldRecord holds the arguments of printRecord.
+type heldRecord struct {
+	sepLeft                 rune
+	path                    string
+	pos                     recordPos
+	line, crc, above, below []byte
+}
+
+// Write drops anything else printed.
+func (t *tailRecords) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (t *tailRecords) add(r heldRecord) {
+	// the line may be in the window of a streamed file, which moves on
+	r.line = append([]byte(nil), r.line...)
+	if len(t.recs) < t.n {
+		t.recs = append(t.recs, r)
+		return
+	}
+	copy(t.recs, t.recs[1:])
+	t.recs[t.n-1] = r
+}
+
+func (t *tailRecords) flush(s *searchConfig, w io.Writer) {
+	for i, r := range t.recs {
+		s.printRecord(w, i == 0, r.sepLeft, r.path, r.pos, r.line, r.crc, r.above, r.below)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimit spreads reads shared by all searches over time, so that they
+// average no more than rate bytes per second.
+type rateLimit struct {
+	rate int64
+	mu   sync.Mutex
+	// next is when the bytes read so far are paid for
+	next time.Time
+}
+
+// wait sleeps until reading n more bytes keeps within the rate.
+func (l *rateLimit) wait(n int) {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(int64(n) * int64(time.Second) / l.rate))
+	until := l.next
+	l.mu.Unlock()
+	time.Sleep(time.Until(until))
+}
+
+// throttleChunk is the most read at once, so the rate stays even.
+const throttleChunk = 64 << 10
+
+type throttledReader struct {
+	r     io.Reader
+	limit *rateLimit
+}
+
+func (t throttledReader) Read(p []byte) (int, error) {
+	if len(p) > throttleChunk {
+		p = p[:throttleChunk]
+	}
+	n, err := t.r.Read(p)
+	t.limit.wait(n)
+	return n, err
+}
+
+// parseRate parses a number of bytes per second with an optional K, M or G
+// suffix, such as 512K.
+func parseRate(s string) (int64, error) {
+	orig, shift := s, 0
+	switch strings.ToUpper(s[len(s)-1:]) {
+	case "K":
+		shift = 10
+	case "M":
+		shift = 20
+	case "G":
+		shift = 30
+	}
+	if shift > 0 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 || n > (1<<62)>>shift {
+		return 0, fmt.Errorf("bad rate %q, expected bytes per second like 512K or 10M", orig)
+	}
+	return n << shift, nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// trailerSepLeft and trailerTag begin the provenance record printed after
+// search output with -trailer. Patch mode ignores it.
+const (
+	trailerSepLeft = '╙'
+	trailerTag     = "gred\t"
+)
+
+// printTrailer describes how the search output was made: its command line,
+// patterns, root, time and number of files with matches.
+func printTrailer(w io.Writer, s *searchConfig) {
+	args := make([]string, len(os.Args))
+	for i, arg := range os.Args {
+		args[i] = arg
+		if arg == "" || strings.ContainsAny(arg, " \t\n\"'\\") {
+			args[i] = strconv.Quote(arg)
+		}
+	}
+	fields := []string{"cmd=" + strings.Join(args, " ")}
+	for _, re := range s.pats {
+		fields = append(fields, "pattern="+strconv.Quote(re.String()))
+	}
+	if root, err := os.Getwd(); err == nil {
+		fields = append(fields, "root="+root)
+	}
+	fields = append(fields,
+		"time="+time.Now().UTC().Format(time.RFC3339),
+		fmt.Sprintf("files=%d", s.summary.matched))
+	fmt.Fprintf(w, "%c%s%s\n", seps.of(trailerSepLeft), trailerTag, strings.Join(fields, "\t"))
+}
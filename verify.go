@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// verifyMode checks the search output and patch apply round trip for each
+// path: every line is searched for, and the unmodified output applied as if
+// each line were edited must reproduce the file byte for byte. Exits 1 when
+// any file fails.
+func verifyMode(paths []string) {
+	if len(paths) == 0 {
+		warn("verify needs the paths of files to check")
+		usage()
+	}
+	failed := false
+	for _, path := range paths {
+		if err := verify(path); err != nil {
+			warn("%s: %v", path, err)
+			failed = true
+			continue
+		}
+		fmt.Printf("%s ok\n", path)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func verify(path string) error {
+	orig, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	// the pattern of every line is compiled directly, since pushPattern
+	// would apply -F, -w, -x, -i and -norm to it
+	everyLine := regexp.MustCompile("(?m)^")
+	cfg := &searchConfig{
+		onError: "abort",
+		pats:    []*regexp.Regexp{everyLine},
+		finders: []finder{newFinder(everyLine)},
+	}
+	var out bytes.Buffer
+	if err := grep(&out, path, cfg); err != nil {
+		return err
+	}
+
+	patches, err := readPatches(&out)
+	switch {
+	case err != nil:
+		return fmt.Errorf("reading search output: %v", err)
+	case len(patches) > 1:
+		return fmt.Errorf("search output has %d paths", len(patches))
+	case len(patches) == 0:
+		if len(orig) > 0 {
+			return fmt.Errorf("search output is empty")
+		}
+		return nil
+	}
+	p := patches[0]
+	for _, ln := range p.all {
+		ln.edit = true
+	}
+	p.lines = anchorEdits(p.all)
+
+	var patched bytes.Buffer
+	if err := p.pipe(&patched, bytes.NewReader(orig)); err != nil {
+		return err
+	}
+	if i := firstDiff(orig, patched.Bytes()); i >= 0 {
+		lineno := 1 + bytes.Count(orig[:i], newline)
+		return fmt.Errorf("round trip differs at line %d, byte %d", lineno, i)
+	}
+	return nil
+}
+
+// firstDiff returns the offset of the first byte where a and b differ, or -1
+// when they are the same.
+func firstDiff(a, b []byte) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return len(a)
+		}
+		return len(b)
+	}
+	return -1
+}
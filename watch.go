@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// watchInterval is how often -watch looks for files which changed. The
+// files are polled rather than watched through the platform's file events,
+// which would need a watch on every directory of large trees and behave
+// differently on each platform.
+const watchInterval = time.Second
+
+// watch searches the files which change after the search s has run, until
+// gred is interrupted. Each file changed, or added, is searched again below
+// a # changed comment naming it, and files removed are named in a # removed
+// one, or with -json in watchRecords. Since a file changed is printed again
+// under the same path, the output of the search, or of each change, may be
+// patched, but not all of it at once.
+func watch(s *searchConfig) error {
+	seen, err := s.watchedFiles()
+	if err != nil {
+		return err
+	}
+	for {
+		time.Sleep(watchInterval)
+		now, err := s.watchedFiles()
+		if err != nil {
+			return err
+		}
+		var changed, removed []string
+		for path, fresh := range now {
+			if was, ok := seen[path]; !ok || !was.same(fresh) {
+				changed = append(changed, path)
+			}
+		}
+		for path := range seen {
+			if _, ok := now[path]; !ok {
+				removed = append(removed, path)
+			}
+		}
+		sort.Strings(changed)
+		sort.Strings(removed)
+		for _, path := range removed {
+			s.printWatchEvent("removed", path)
+		}
+		for _, path := range changed {
+			s.printWatchEvent("changed", path)
+			if err := s.fileError(grep(s.stdout, path, s)); err != nil {
+				return err
+			}
+		}
+		if s.cache != nil && len(changed) > 0 {
+			if err := s.cache.write(); err != nil {
+				warn("cache: %v", err)
+			}
+		}
+		flushOutput()
+		seen = now
+	}
+}
+
+// printWatchEvent notes that the file at path changed or was removed.
+func (s *searchConfig) printWatchEvent(event, path string) {
+	if s.json {
+		printJSON(s.stdout, watchRecord{Schema: watchSchemaID, Event: event, Path: s.displayPath(path)})
+		return
+	}
+	fmt.Fprintf(s.stdout, "# %s %s\n", event, s.displayPath(path))
+}
+
+// watchedFiles returns the freshness of the files the search reads, walking
+// the directories again for those added since.
+func (s *searchConfig) watchedFiles() (map[string]freshness, error) {
+	paths := s.files
+	if len(paths) == 0 && s.globs != nil {
+		s.found, s.collectOnly = nil, true
+		defer func() { s.collectOnly = false }()
+		roots := s.dirs
+		if roots == nil {
+			roots = []string{"."}
+		}
+		for _, root := range roots {
+			if err := walk(root, s); err != nil {
+				return nil, err
+			}
+		}
+		paths = s.found
+	}
+	files := make(map[string]freshness, len(paths))
+	for _, path := range paths {
+		finfo, err := os.Stat(longPath(path))
+		if err == nil && finfo.Mode().IsRegular() {
+			files[path] = freshness{finfo.Size(), finfo.ModTime()}
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// copyXattrs copies the extended attributes of the file src onto dst, among
+// them the SELinux security context, which a new file would otherwise take
+// from its directory. Those the file system of dst does not support are left
+// out.
+func copyXattrs(dst, src string) error {
+	names, err := listXattrs(src)
+	if err != nil {
+		if xattrsUnsupported(err) {
+			return nil
+		}
+		return err
+	}
+	for _, name := range names {
+		value, err := getXattr(src, name)
+		if err == syscall.ENODATA {
+			// removed since it was listed
+			continue
+		}
+		if err == nil {
+			err = syscall.Setxattr(dst, name, value, 0)
+		}
+		if err != nil && !xattrsUnsupported(err) {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+func xattrsUnsupported(err error) bool {
+	return err == syscall.ENOTSUP || err == syscall.EOPNOTSUPP
+}
+
+// listXattrs returns the names of the extended attributes of path, sizing
+// the list again should they grow between asking for its size and it.
+func listXattrs(path string) ([]string, error) {
+	for {
+		size, err := syscall.Listxattr(path, nil)
+		if err != nil || size == 0 {
+			return nil, err
+		}
+		buf := make([]byte, size)
+		n, err := syscall.Listxattr(path, buf)
+		if err == syscall.ERANGE {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		var names []string
+		start := 0
+		for i, c := range buf[:n] {
+			if c == 0 {
+				if i > start {
+					names = append(names, string(buf[start:i]))
+				}
+				start = i + 1
+			}
+		}
+		return names, nil
+	}
+}
+
+func getXattr(path, name string) ([]byte, error) {
+	for {
+		size, err := syscall.Getxattr(path, name, nil)
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size)
+		n, err := syscall.Getxattr(path, name, buf)
+		if err == syscall.ERANGE {
+			continue
+		}
+		return buf[:n], err
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// TestPatchKeepsXattrs checks that a patched file keeps the extended
+// attributes of the original it replaces.
+func TestPatchKeepsXattrs(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"a.txt": "one\ntwo foo\n"})
+	path := filepath.Join(dir, "a.txt")
+	if err := syscall.Setxattr(path, "user.gred", []byte("kept"), 0); err != nil {
+		if xattrsUnsupported(err) {
+			t.Skip("the file system has no user extended attributes")
+		}
+		t.Fatal(err)
+	}
+	out := runGred(t, dir, "", nil, "-replace", "bar", "foo", "@a.txt")
+	if r := runGred(t, dir, out.stdout, nil, "-p"); r.code != 0 {
+		t.Fatalf("exit %d\n%s", r.code, r.stderr)
+	}
+	if got := readTestFile(t, dir, "a.txt"); got != "one\ntwo bar\n" {
+		t.Errorf("the file has %q", got)
+	}
+	value, err := getXattr(path, "user.gred")
+	if err != nil {
+		t.Fatalf("user.gred: %v", err)
+	}
+	if string(value) != "kept" {
+		t.Errorf("user.gred is %q, want %q", value, "kept")
+	}
+}